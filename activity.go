@@ -0,0 +1,242 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/thedevsaddam/renderer"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// requestUser returns who is making the request, as identified by the
+// configured user header. It is empty for anonymous requests.
+func requestUser(r *http.Request) string {
+	return strings.TrimSpace(r.Header.Get(cfg.userHeader))
+}
+
+// mutationStamp returns the fields every change to a todo sets, recording
+// when it happened and who made it.
+func mutationStamp(r *http.Request) bson.M {
+	stamp := bson.M{"updatedAt": time.Now()}
+	if user := requestUser(r); user != "" {
+		stamp["lastUpdatedBy"] = user
+	}
+	return stamp
+}
+
+// migrateUpdatedAt backfills updatedAt for todos stored before the field
+// existed, using their creation time.
+func migrateUpdatedAt() {
+	todos := []todoModel{}
+	checkErr(db.C(collectionName).Find(bson.M{"updatedAt": bson.M{"$exists": false}}).
+		Select(bson.M{"createdAt": 1}).All(&todos))
+	for _, t := range todos {
+		checkErr(db.C(collectionName).UpdateId(t.ID, bson.M{"$set": bson.M{"updatedAt": t.CreatedAt}}))
+	}
+}
+
+// changes reports whether applying set and unset to current would alter
+// any stored field. Both sides are compared in their stored form, so
+// timestamps are compared at MongoDB's millisecond precision.
+func changes(current todoModel, set, unset bson.M) bool {
+	stored, err := storedForm(current)
+	if err != nil {
+		return true
+	}
+	updated, err := storedForm(set)
+	if err != nil {
+		return true
+	}
+	for field, value := range updated {
+		if !reflect.DeepEqual(stored[field], value) {
+			return true
+		}
+	}
+	for field := range unset {
+		if _, ok := stored[field]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func storedForm(v interface{}) (bson.M, error) {
+	data, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	doc := bson.M{}
+	err = bson.Unmarshal(data, &doc)
+	return doc, err
+}
+
+// ownerActivity lists the todos an owner created or last updated, most
+// recently updated first.
+func ownerActivity(w http.ResponseWriter, r *http.Request) {
+	owner := strings.TrimSpace(r.URL.Query().Get("owner"))
+	if owner == "" {
+		rnd.JSON(w, http.StatusBadRequest, renderer.M{
+			"message": msg(r, "owner is required"),
+		})
+		return
+	}
+
+	skip, limit, err := pagination(r.URL.Query())
+	if err != nil {
+		badRequest(w, r, err)
+		return
+	}
+
+	query := db.C(collectionName).Find(bson.M{"$or": []bson.M{
+		{"owner": owner},
+		{"lastUpdatedBy": owner},
+	}})
+
+	total, err := query.Count()
+	if err != nil {
+		rnd.JSON(w, http.StatusBadRequest, renderer.M{
+			"message": msg(r, "Failed to get todos"),
+			"error":   err,
+		})
+		return
+	}
+
+	todos := []todoModel{}
+	if err := query.Sort("-updatedAt", "-_id").Skip(skip).Limit(limit).All(&todos); err != nil {
+		rnd.JSON(w, http.StatusBadRequest, renderer.M{
+			"message": msg(r, "Failed to get todos"),
+			"error":   err,
+		})
+		return
+	}
+
+	todoList := []todo{}
+	for _, t := range todos {
+		todoList = append(todoList, toTodo(t))
+	}
+
+	rnd.JSON(w, http.StatusOK, renderer.M{
+		"data":   todoList,
+		"total":  total,
+		"offset": skip,
+		"limit":  limit,
+	})
+}
+
+// touchTodo bumps a todo's updatedAt without changing anything else, so it
+// resurfaces at the top of recency sorted views.
+func touchTodo(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSpace(chi.URLParam(r, "id"))
+
+	if !bson.IsObjectIdHex(id) {
+		rnd.JSON(w, http.StatusBadRequest, renderer.M{
+			"message": msg(r, "Invalid id"),
+		})
+		return
+	}
+
+	var t todoModel
+	change := mgo.Change{Update: bson.M{"$set": bson.M{"updatedAt": time.Now()}}, ReturnNew: true}
+	if err := applyChange(db.C(collectionName), bson.M{"_id": bson.ObjectIdHex(id)}, change, &t); err != nil {
+		if err == mgo.ErrNotFound {
+			rnd.JSON(w, http.StatusNotFound, renderer.M{
+				"message": msg(r, "Todo not found"),
+			})
+			return
+		}
+		writeFailed(w, r, "Failed to touch todo", err)
+		return
+	}
+
+	rnd.JSON(w, http.StatusOK, renderer.M{
+		"message": msg(r, "Todo touched successfully"),
+		"data":    toTodo(t),
+	})
+}
+
+// openWork lists an owner's incomplete todos, highest priority first and
+// then by due date, soonest first and todos without one last. Archived
+// todos and todos scheduled to start later are left out. The owner
+// defaults to the requesting user.
+func openWork(w http.ResponseWriter, r *http.Request) {
+	owner := strings.TrimSpace(r.URL.Query().Get("owner"))
+	if owner == "" {
+		owner = requestUser(r)
+	}
+	if owner == "" {
+		rnd.JSON(w, http.StatusBadRequest, renderer.M{
+			"message": msg(r, "owner is required"),
+		})
+		return
+	}
+
+	skip, limit, err := pagination(r.URL.Query())
+	if err != nil {
+		badRequest(w, r, err)
+		return
+	}
+
+	filter, err := todoFilter(url.Values{"completed": {"false"}})
+	if err != nil {
+		badRequest(w, r, err)
+		return
+	}
+	filter["owner"] = owner
+
+	total, err := db.C(collectionName).Find(filter).Count()
+	if err != nil {
+		rnd.JSON(w, http.StatusBadRequest, renderer.M{
+			"message": msg(r, "Failed to get todos"),
+			"error":   err,
+		})
+		return
+	}
+
+	// Priorities don't sort alphabetically, so rank them first.
+	todos := []todoModel{}
+	err = db.C(collectionName).Pipe([]bson.M{
+		{"$match": filter},
+		{"$addFields": bson.M{
+			"priorityRank": bson.M{"$switch": bson.M{
+				"branches": []bson.M{
+					{"case": bson.M{"$eq": []interface{}{"$priority", priorityHigh}}, "then": 2},
+					{"case": bson.M{"$eq": []interface{}{"$priority", priorityLow}}, "then": 0},
+				},
+				"default": 1,
+			}},
+			"noDueDate": bson.M{"$cond": []interface{}{bson.M{"$ifNull": []interface{}{"$dueDate", false}}, 0, 1}},
+		}},
+		{"$sort": bson.D{
+			{Name: "priorityRank", Value: -1},
+			{Name: "noDueDate", Value: 1},
+			{Name: "dueDate", Value: 1},
+			{Name: "_id", Value: 1},
+		}},
+		{"$skip": skip},
+		{"$limit": limit},
+	}).All(&todos)
+	if err != nil {
+		rnd.JSON(w, http.StatusBadRequest, renderer.M{
+			"message": msg(r, "Failed to get todos"),
+			"error":   err,
+		})
+		return
+	}
+
+	todoList := []todo{}
+	for _, t := range todos {
+		todoList = append(todoList, toTodo(t))
+	}
+
+	rnd.JSON(w, http.StatusOK, renderer.M{
+		"data":   todoList,
+		"total":  total,
+		"offset": skip,
+		"limit":  limit,
+	})
+}
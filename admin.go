@@ -0,0 +1,104 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/thedevsaddam/renderer"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var sessionModes = map[mgo.Mode]string{
+	mgo.Primary:            "primary",
+	mgo.PrimaryPreferred:   "primaryPreferred",
+	mgo.Secondary:          "secondary",
+	mgo.SecondaryPreferred: "secondaryPreferred",
+	mgo.Nearest:            "nearest",
+	mgo.Eventual:           "eventual",
+	mgo.Monotonic:          "monotonic",
+}
+
+// requireAdmin only lets through requests carrying the configured admin
+// token as a bearer token. The admin API is disabled when no token is set.
+func requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cfg.adminToken == "" {
+			rnd.JSON(w, http.StatusForbidden, renderer.M{
+				"message": msg(r, "Admin API is disabled"),
+			})
+			return
+		}
+
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(cfg.adminToken)) != 1 {
+			rnd.JSON(w, http.StatusUnauthorized, renderer.M{
+				"message": msg(r, "Unauthorized"),
+			})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func dbStats(w http.ResponseWriter, r *http.Request) {
+	session := db.Session
+
+	start := time.Now()
+	pingErr := session.Ping()
+	latency := time.Since(start)
+
+	ping := renderer.M{
+		"ok":        pingErr == nil,
+		"latencyMs": float64(latency.Microseconds()) / 1000,
+	}
+	if pingErr != nil {
+		ping["error"] = pingErr.Error()
+	}
+
+	// Only pass through build details that are safe to show; buildInfo
+	// also reports things like compile flags and the host environment.
+	var info bson.M
+	build := renderer.M{}
+	if err := db.Run("buildInfo", &info); err == nil {
+		for _, key := range []string{"version", "gitVersion", "bits", "maxBsonObjectSize"} {
+			if v, ok := info[key]; ok {
+				build[key] = v
+			}
+		}
+	} else {
+		build["error"] = err.Error()
+	}
+
+	stats := mgo.GetStats()
+
+	rnd.JSON(w, http.StatusOK, renderer.M{
+		"data": renderer.M{
+			"mode": sessionModes[session.Mode()],
+			"pool": renderer.M{
+				"clusters":     stats.Clusters,
+				"masterConns":  stats.MasterConns,
+				"slaveConns":   stats.SlaveConns,
+				"socketsAlive": stats.SocketsAlive,
+				"socketsInUse": stats.SocketsInUse,
+				"socketRefs":   stats.SocketRefs,
+				"sentOps":      stats.SentOps,
+				"receivedOps":  stats.ReceivedOps,
+			},
+			"ping":      ping,
+			"buildInfo": build,
+		},
+	})
+}
+
+func adminHandlers() http.Handler {
+	rg := chi.NewRouter()
+	rg.Use(requireAdmin)
+	rg.Get("/db-stats", dbStats)
+
+	return rg
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/thedevsaddam/renderer"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type batchPriority struct {
+	IDs      []string `json:"ids"`
+	Priority string   `json:"priority"`
+}
+
+// splitIDs separates valid object ids from the ones that are malformed.
+func splitIDs(ids []string) ([]bson.ObjectId, []string) {
+	valid := []bson.ObjectId{}
+	invalid := []string{}
+	for _, id := range ids {
+		id = strings.TrimSpace(id)
+		if bson.IsObjectIdHex(id) {
+			valid = append(valid, bson.ObjectIdHex(id))
+		} else {
+			invalid = append(invalid, id)
+		}
+	}
+	return valid, invalid
+}
+
+func batchUpdatePriority(w http.ResponseWriter, r *http.Request) {
+	var b batchPriority
+
+	if err := json.NewDecoder(r.Body).Decode(&b); err != nil {
+		rnd.JSON(w, http.StatusBadRequest, renderer.M{
+			"message": msg(r, "Invalid request body"),
+		})
+		return
+	}
+
+	if !validPriority(b.Priority) {
+		rnd.JSON(w, http.StatusBadRequest, renderer.M{
+			"message": msg(r, "Invalid priority"),
+		})
+		return
+	}
+
+	if len(b.IDs) == 0 {
+		rnd.JSON(w, http.StatusBadRequest, renderer.M{
+			"message": msg(r, "ids are required"),
+		})
+		return
+	}
+
+	ids, invalid := splitIDs(b.IDs)
+
+	matched := 0
+	info := &mgo.ChangeInfo{}
+	if len(ids) > 0 {
+		var err error
+		matched, err = db.C(collectionName).Find(bson.M{"_id": bson.M{"$in": ids}}).Count()
+		if err != nil {
+			rnd.JSON(w, http.StatusBadRequest, renderer.M{
+				"message": msg(r, "Failed to update todos"),
+				"error":   err,
+			})
+			return
+		}
+
+		// Only todos whose priority changes are stamped as updated, so
+		// modified counts the todos that actually changed.
+		set := mutationStamp(r)
+		set["priority"] = b.Priority
+		info, err = db.C(collectionName).UpdateAll(
+			bson.M{"_id": bson.M{"$in": ids}, "priority": bson.M{"$ne": b.Priority}},
+			bson.M{"$set": set},
+		)
+		if err != nil {
+			writeFailed(w, r, "Failed to update todos", err)
+			return
+		}
+		if info == nil {
+			info = &mgo.ChangeInfo{}
+		}
+	}
+
+	rnd.JSON(w, http.StatusOK, renderer.M{
+		"message":    msg(r, "Todos updated successfully"),
+		"matched":    matched,
+		"modified":   info.Updated,
+		"invalidIds": invalid,
+	})
+}
+
+// maxBatchQueries bounds how many sub-queries a batch query may run.
+const maxBatchQueries = 20
+
+type batchQueryResult struct {
+	todoPage
+	Error string `json:"error,omitempty"`
+}
+
+// batchQuery runs several listings in one request. Each sub-query is an
+// object of the GET /todo query parameters plus offset and limit, and
+// gets a result set in the same position. An invalid sub-query reports
+// its error in its own result without failing the others.
+func batchQuery(w http.ResponseWriter, r *http.Request) {
+	var queries []map[string]interface{}
+
+	dec := json.NewDecoder(r.Body)
+	dec.UseNumber()
+	if err := dec.Decode(&queries); err != nil {
+		rnd.JSON(w, http.StatusBadRequest, renderer.M{
+			"message": msg(r, "Invalid request body"),
+		})
+		return
+	}
+
+	if len(queries) > maxBatchQueries {
+		rnd.JSON(w, http.StatusBadRequest, renderer.M{
+			"message": msg(r, "Too many queries"),
+		})
+		return
+	}
+
+	results := []batchQueryResult{}
+	for _, params := range queries {
+		q, err := queryValues(params)
+		result := batchQueryResult{}
+		if err == nil {
+			result.todoPage, err = listTodos(q)
+		}
+		if err != nil {
+			result = batchQueryResult{todoPage: todoPage{Data: []todo{}}, Error: msg(r, err.Error())}
+		}
+		results = append(results, result)
+	}
+
+	rnd.JSON(w, http.StatusOK, renderer.M{
+		"data": results,
+	})
+}
+
+// queryValues turns one batch query into query-string parameters. Numbers
+// keep the text they were sent as; objects, arrays and null have no
+// query-string form and are rejected.
+func queryValues(params map[string]interface{}) (url.Values, error) {
+	q := url.Values{}
+	for key, value := range params {
+		switch v := value.(type) {
+		case string:
+			q.Set(key, v)
+		case json.Number:
+			q.Set(key, v.String())
+		case bool:
+			q.Set(key, strconv.FormatBool(v))
+		default:
+			return nil, errors.New("Invalid query parameter")
+		}
+	}
+	return q, nil
+}
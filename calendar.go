@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/thedevsaddam/renderer"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const icalTimeLayout = "20060102T150405Z"
+
+var icalEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+// calendarFeed renders the incomplete, unarchived todos that have a due
+// date as an iCalendar feed calendar apps can subscribe to.
+func calendarFeed(w http.ResponseWriter, r *http.Request) {
+	todos := []todoModel{}
+
+	if err := capItems(db.C(collectionName).Find(bson.M{
+		"completed": false,
+		"archived":  bson.M{"$ne": true},
+		"dueDate":   bson.M{"$exists": true},
+	}).Sort("dueDate")).All(&todos); err != nil {
+		rnd.JSON(w, http.StatusBadRequest, renderer.M{
+			"message": msg(r, "Failed to get todos"),
+			"error":   err,
+		})
+		return
+	}
+	if tooManyItems(w, r, len(todos)) {
+		return
+	}
+
+	var b strings.Builder
+	line := func(format string, args ...interface{}) {
+		b.WriteString(foldICalLine(fmt.Sprintf(format, args...)))
+		b.WriteString("\r\n")
+	}
+
+	now := time.Now().UTC().Format(icalTimeLayout)
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//goTodo//todo-app//EN")
+	for _, t := range todos {
+		line("BEGIN:VTODO")
+		line("UID:%s@todo-app", t.ID.Hex())
+		line("DTSTAMP:%s", now)
+		line("CREATED:%s", t.CreatedAt.UTC().Format(icalTimeLayout))
+		line("SUMMARY:%s", icalEscaper.Replace(plainTitle(t)))
+		line("DUE:%s", t.DueDate.UTC().Format(icalTimeLayout))
+		line("STATUS:%s", icalStatus(t.Status))
+		line("END:VTODO")
+	}
+	line("END:VCALENDAR")
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="todos.ics"`)
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write([]byte(b.String())); err != nil {
+		requestLog(r).Println("Failed to write calendar feed", err)
+	}
+}
+
+func icalStatus(status string) string {
+	if status == statusDoing {
+		return "IN-PROCESS"
+	}
+	return "NEEDS-ACTION"
+}
+
+// foldICalLine splits content lines longer than 75 octets as required by
+// RFC 5545, without breaking multi-byte characters.
+func foldICalLine(s string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range s {
+		size := len(string(r))
+		if n+size > 75 {
+			b.WriteString("\r\n ")
+			n = 1
+		}
+		b.WriteRune(r)
+		n += size
+	}
+	return b.String()
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/thedevsaddam/renderer"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// claimTodo atomically takes the oldest unclaimed todo that is still to
+// do, moving it to doing and recording the requesting user as claimedBy.
+// The find and the update happen in one findAndModify, so concurrent
+// workers never claim the same todo. Responds 204 when nothing is left.
+func claimTodo(w http.ResponseWriter, r *http.Request) {
+	user := requestUser(r)
+	if user == "" {
+		rnd.JSON(w, http.StatusBadRequest, renderer.M{
+			"message": msg(r, "A user is required to claim todos"),
+		})
+		return
+	}
+
+	now := time.Now()
+	set := mutationStamp(r)
+	set["status"] = statusDoing
+	set["claimedBy"] = user
+	set["claimedAt"] = now
+
+	var t todoModel
+	err := applyChange(db.C(collectionName), bson.M{
+		"status":    statusTodo,
+		"claimedBy": bson.M{"$exists": false},
+		"archived":  bson.M{"$ne": true},
+		"$or": []bson.M{
+			{"startAt": bson.M{"$exists": false}},
+			{"startAt": bson.M{"$lte": now}},
+		},
+	}, mgo.Change{Update: bson.M{"$set": set}, ReturnNew: true}, &t, "createdAt", "_id")
+	if err == mgo.ErrNotFound {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if err != nil {
+		writeFailed(w, r, "Failed to claim todo", err)
+		return
+	}
+
+	rnd.JSON(w, http.StatusOK, renderer.M{
+		"message": msg(r, "Todo claimed successfully"),
+		"data":    toTodo(t),
+	})
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// config holds the settings that can be tuned through the environment.
+type config struct {
+	// normalizeTitles trims titles and collapses runs of internal
+	// whitespace to a single space before they are stored.
+	normalizeTitles bool
+
+	// adminToken is the bearer token guarding the admin API. The admin
+	// API is disabled when it is empty.
+	adminToken string
+
+	// maxConcurrentRequests caps the number of requests served at once.
+	// Zero means no limit.
+	maxConcurrentRequests int
+
+	// titleKey is the base64 encoded AES key used to encrypt titles at
+	// rest. Titles are stored in plain text when it is empty.
+	titleKey string
+
+	// slowRequestThreshold is how long a request may take before it is
+	// logged as slow. Zero disables the slow request log.
+	slowRequestThreshold time.Duration
+
+	// writeConcern is one of "unacknowledged", "acknowledged" or
+	// "majority". writeTimeoutMs bounds how long a majority write waits
+	// for replication.
+	writeConcern   string
+	writeTimeoutMs int
+
+	// templateDir is the directory holding home.tpl and the error pages.
+	templateDir string
+
+	// disableHTML runs the server as a pure API: / serves the JSON API
+	// index, errors are always JSON and no templates are loaded.
+	disableHTML bool
+
+	// maxHeaderBytes limits the size of request headers, including the
+	// request line.
+	maxHeaderBytes int
+
+	// shutdownGracePeriod is how long the server keeps serving after
+	// /healthz starts reporting not ready, giving load balancers time to
+	// stop sending traffic before connections are closed.
+	shutdownGracePeriod time.Duration
+
+	// userHeader is the request header identifying the user making the
+	// request, typically set by an authenticating proxy.
+	userHeader string
+
+	// requireUserAgent rejects requests without a User-Agent header,
+	// except for paths under one of userAgentExempt.
+	requireUserAgent bool
+	userAgentExempt  []string
+
+	// defaultTags are given to created todos that don't specify tags.
+	defaultTags []string
+
+	// emptySearchMatchesNothing makes an empty q= search term return no
+	// todos instead of applying no search filter.
+	emptySearchMatchesNothing bool
+
+	// jobInterval is how often the background jobs run.
+	jobInterval time.Duration
+
+	// autoCompleteOverdueAfter enables a background job completing todos
+	// that have been overdue for longer than this. Zero disables it.
+	autoCompleteOverdueAfter time.Duration
+
+	// readOnlyWindows are the daily time ranges during which mutating
+	// requests are rejected.
+	readOnlyWindows []timeWindow
+
+	// maxResponseItems caps the number of todos a listing, export, tree
+	// or grouped response may contain. Zero means no cap.
+	maxResponseItems int
+
+	// focusWeights weigh the scores ranking todos for GET /todo/focus.
+	focusWeights focusWeights
+
+	// indexes are the fields indexed at startup.
+	indexes []string
+
+	// warmUp runs a few queries before serving so the first request
+	// doesn't pay for cold connections and indexes.
+	warmUp bool
+
+	// maxTodosPerOwner caps how many todos one owner can have. Zero
+	// means no limit.
+	maxTodosPerOwner int
+
+	// limitWarningPercent is the share of a limit, in percent, from which
+	// creates warn that the limit is close.
+	limitWarningPercent int
+
+	// dedupeWindow rejects creating a todo with the same owner, title and
+	// description as one created this recently. Zero disables it.
+	dedupeWindow time.Duration
+
+	// archiveCompletedAfter enables a background job archiving todos
+	// completed longer ago than this. Zero disables it.
+	archiveCompletedAfter time.Duration
+
+	// dateFormats are the names of the timestamp formats clients may
+	// use, tried in order.
+	dateFormats []string
+
+	// requestIDHeader carries the id correlating a request's log lines,
+	// accepted from clients and returned in responses.
+	requestIDHeader string
+}
+
+var cfg config
+
+func loadConfig() config {
+	return config{
+		normalizeTitles: envBool("TODO_NORMALIZE_TITLES", false),
+		adminToken:      os.Getenv("TODO_ADMIN_TOKEN"),
+
+		maxConcurrentRequests: envInt("TODO_MAX_CONCURRENT_REQUESTS", 0),
+		titleKey:              os.Getenv("TODO_TITLE_KEY"),
+		slowRequestThreshold:  envDuration("TODO_SLOW_REQUEST_THRESHOLD", 500*time.Millisecond),
+		writeConcern:          os.Getenv("TODO_WRITE_CONCERN"),
+		writeTimeoutMs:        envInt("TODO_WRITE_TIMEOUT_MS", 5000),
+		templateDir:           envString("TODO_TEMPLATE_DIR", "static"),
+		disableHTML:           envBool("TODO_DISABLE_HTML", false),
+		maxHeaderBytes:        envInt("TODO_MAX_HEADER_BYTES", http.DefaultMaxHeaderBytes),
+		shutdownGracePeriod:   envDuration("TODO_SHUTDOWN_GRACE_PERIOD", 0),
+		userHeader:            envString("TODO_USER_HEADER", "X-User"),
+		requireUserAgent:      envBool("TODO_REQUIRE_USER_AGENT", false),
+		userAgentExempt:       envList("TODO_USER_AGENT_EXEMPT", []string{"/healthz", "/admin"}),
+		defaultTags:           envList("TODO_DEFAULT_TAGS", nil),
+
+		emptySearchMatchesNothing: envString("TODO_EMPTY_SEARCH", "all") == "none",
+		jobInterval:               envDuration("TODO_JOB_INTERVAL", time.Minute),
+		autoCompleteOverdueAfter:  envDuration("TODO_AUTO_COMPLETE_OVERDUE_AFTER", 0),
+		readOnlyWindows:           parseWindows(envList("TODO_READ_ONLY_WINDOWS", nil)),
+		maxResponseItems:          envInt("TODO_MAX_RESPONSE_ITEMS", 0),
+		focusWeights:              parseFocusWeights(envList("TODO_FOCUS_WEIGHTS", nil)),
+		indexes:                   envList("TODO_INDEXES", indexedFields),
+		warmUp:                    envBool("TODO_WARM_UP", false),
+		maxTodosPerOwner:          envInt("TODO_MAX_TODOS_PER_OWNER", 0),
+		limitWarningPercent:       envInt("TODO_LIMIT_WARNING_PERCENT", 90),
+		dedupeWindow:              envDuration("TODO_DEDUPE_WINDOW", 0),
+		archiveCompletedAfter:     envDuration("TODO_ARCHIVE_COMPLETED_AFTER", 0),
+		requestIDHeader:           envString("TODO_REQUEST_ID_HEADER", "X-Request-Id"),
+		dateFormats: acceptedDateFormats(
+			envBool("TODO_STRICT_DATES", false),
+			envList("TODO_DATE_FORMATS", []string{"rfc3339", "datetime", "date", "unix"}),
+		),
+	}
+}
+
+func envString(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// envList reads a comma separated list, ignoring empty entries.
+func envList(key string, def []string) []string {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return def
+	}
+	list := []string{}
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func envBool(key string, def bool) bool {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		log.Printf("Ignoring invalid %s=%q, using %v", key, v, def)
+		return def
+	}
+	return b
+}
+
+func envInt(key string, def int) int {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Printf("Ignoring invalid %s=%q, using %v", key, v, def)
+		return def
+	}
+	return n
+}
+
+func envDuration(key string, def time.Duration) time.Duration {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Printf("Ignoring invalid %s=%q, using %v", key, v, def)
+		return def
+	}
+	return d
+}
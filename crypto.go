@@ -0,0 +1,98 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"log"
+)
+
+// titleCipher encrypts titles at rest. It is nil when no key is configured.
+var titleCipher cipher.AEAD
+
+func newTitleCipher(key string) (cipher.AEAD, error) {
+	if key == "" {
+		return nil, nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, errors.New("TODO_TITLE_KEY must be base64 encoded")
+	}
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// contentKey keys the content hashes of dedupe markers, so a stored hash
+// can't be matched against guessed titles when titles are encrypted. It is
+// nil when no key is configured.
+var contentKey []byte
+
+// newContentKey derives the dedupe hash key from the title key, so the
+// AES key itself is never used for hashing.
+func newContentKey(key string) ([]byte, error) {
+	if key == "" {
+		return nil, nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, errors.New("TODO_TITLE_KEY must be base64 encoded")
+	}
+	mac := hmac.New(sha256.New, raw)
+	mac.Write([]byte("todo content hash"))
+	return mac.Sum(nil), nil
+}
+
+// sealTitle returns the title as it should be stored, and whether it was
+// encrypted.
+func sealTitle(title string) (string, bool, error) {
+	if titleCipher == nil {
+		return title, false, nil
+	}
+	nonce := make([]byte, titleCipher.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", false, err
+	}
+	sealed := titleCipher.Seal(nonce, nonce, []byte(title), nil)
+	return base64.StdEncoding.EncodeToString(sealed), true, nil
+}
+
+func openTitle(stored string) (string, error) {
+	if titleCipher == nil {
+		return "", errors.New("title is encrypted but no key is configured")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(stored)
+	if err != nil {
+		return "", err
+	}
+	n := titleCipher.NonceSize()
+	if len(sealed) < n {
+		return "", errors.New("encrypted title is truncated")
+	}
+	plain, err := titleCipher.Open(nil, sealed[:n], sealed[n:], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// plainTitle returns the readable title of a stored todo. Todos written
+// before encryption was enabled are stored in plain text and returned as is.
+func plainTitle(t todoModel) string {
+	if !t.TitleEncrypted {
+		return t.Title
+	}
+	title, err := openTitle(t.Title)
+	if err != nil {
+		log.Println("Failed to decrypt title of todo", t.ID.Hex(), err)
+		return ""
+	}
+	return title
+}
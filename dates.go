@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thedevsaddam/renderer"
+)
+
+// dateFormat is a way clients may write timestamps.
+type dateFormat struct {
+	// example shows the format in error responses.
+	example string
+	parse   func(string) (time.Time, error)
+}
+
+func layout(layout string) func(string) (time.Time, error) {
+	return func(s string) (time.Time, error) {
+		return time.Parse(layout, s)
+	}
+}
+
+// dateFormats are the formats that can be enabled by name. Formats
+// without a zone are read as UTC.
+var dateFormats = map[string]dateFormat{
+	"rfc3339":  {example: "2006-01-02T15:04:05Z07:00", parse: layout(time.RFC3339)},
+	"datetime": {example: "2006-01-02T15:04:05", parse: layout("2006-01-02T15:04:05")},
+	"date":     {example: "2006-01-02", parse: layout("2006-01-02")},
+	"unix":     {example: "Unix seconds, e.g. 1136214245", parse: parseUnix},
+}
+
+// parseUnix reads Unix seconds. Only values with 9 to 11 digits, dates
+// from 1973 to 5138, are accepted, so a compact date like 20240501 isn't
+// read as a moment in 1970.
+func parseUnix(s string) (time.Time, error) {
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if n < 1e8 || n >= 1e11 {
+		return time.Time{}, errors.New("implausible Unix timestamp")
+	}
+	return time.Unix(int64(n), 0), nil
+}
+
+// dateError reports an unparseable timestamp in field.
+type dateError struct {
+	field string
+}
+
+func (e *dateError) Error() string {
+	return "Invalid " + e.field
+}
+
+// acceptedDateFormats returns the enabled formats, in order. RFC 3339 is
+// always accepted, and is the only format in strict mode. Unknown names
+// are logged and skipped.
+func acceptedDateFormats(strict bool, names []string) []string {
+	formats := []string{"rfc3339"}
+	if strict {
+		return formats
+	}
+	for _, name := range names {
+		if _, ok := dateFormats[name]; !ok {
+			log.Printf("Ignoring unknown date format %q", name)
+			continue
+		}
+		if name != "rfc3339" {
+			formats = append(formats, name)
+		}
+	}
+	return formats
+}
+
+// parseTime parses a timestamp supplied by a client in any of the
+// accepted formats, normalized to UTC.
+func parseTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	var err error
+	for _, name := range cfg.dateFormats {
+		var t time.Time
+		if t, err = dateFormats[name].parse(s); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, err
+}
+
+// badRequest responds 400 with the translated message of err. Date errors
+// also list the accepted formats.
+func badRequest(w http.ResponseWriter, r *http.Request, err error) {
+	response := renderer.M{"message": msg(r, err.Error())}
+	if _, ok := err.(*dateError); ok {
+		response["acceptedFormats"] = dateExamples()
+	}
+	rnd.JSON(w, http.StatusBadRequest, response)
+}
+
+func dateExamples() []string {
+	examples := []string{}
+	for _, name := range cfg.dateFormats {
+		examples = append(examples, dateFormats[name].example)
+	}
+	return examples
+}
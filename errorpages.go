@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"path/filepath"
+
+	"github.com/thedevsaddam/renderer"
+)
+
+// apiPrefixes are the path prefixes served by the JSON API. Everything else
+// is a browser facing route.
+var apiPrefixes = []string{"/todo", "/admin", "/healthz"}
+
+func isAPIPath(path string) bool {
+	return hasPathPrefix(path, apiPrefixes)
+}
+
+// htmlTemplates are the pages served to browsers, parsed once at startup.
+var htmlTemplates = []string{"home.tpl", "404.tpl", "500.tpl"}
+
+var templates = map[string]*template.Template{}
+
+// loadTemplates parses the HTML templates. A template that fails to parse
+// is logged and answered with an error when requested, rather than
+// stopping the server.
+func loadTemplates() {
+	for _, name := range htmlTemplates {
+		t, err := template.ParseFiles(filepath.Join(cfg.templateDir, name))
+		if err != nil {
+			log.Println("Failed to load template", name, err)
+			continue
+		}
+		templates[name] = t
+	}
+}
+
+// renderTemplate renders the named template. Unlike rnd.Template it
+// reports a missing or broken template as an error before anything has
+// been written, so callers can still respond.
+func renderTemplate(w http.ResponseWriter, status int, name string, data interface{}) error {
+	t, ok := templates[name]
+	if !ok {
+		return fmt.Errorf("template %s is not loaded", name)
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// errorPage responds with the HTML error page for status to browsers on
+// non-API routes, and with a JSON error everywhere else or when the HTML
+// pages are disabled.
+func errorPage(w http.ResponseWriter, r *http.Request, status int, message string) {
+	message = msg(r, message)
+	if cfg.disableHTML || isAPIPath(r.URL.Path) || negotiate(r, "application/json", "text/html") != "text/html" {
+		rnd.JSON(w, status, renderer.M{
+			"message": message,
+		})
+		return
+	}
+
+	data := renderer.M{"Status": status, "Message": message}
+	if err := renderTemplate(w, status, errorTemplate(status), data); err != nil {
+		requestLog(r).Println("Failed to render error page", err)
+		http.Error(w, message, status)
+	}
+}
+
+func errorTemplate(status int) string {
+	if status == http.StatusNotFound {
+		return "404.tpl"
+	}
+	return "500.tpl"
+}
+
+func notFound(w http.ResponseWriter, r *http.Request) {
+	errorPage(w, r, http.StatusNotFound, "Page not found")
+}
+
+// recoverErrors turns handler panics into a 500 response instead of a
+// dropped connection.
+func recoverErrors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if rec := recover(); rec != nil {
+				if rec == http.ErrAbortHandler {
+					panic(rec)
+				}
+				requestLog(r).Printf("Panic serving %s %s: %v", r.Method, r.URL.Path, rec)
+				errorPage(w, r, http.StatusInternalServerError, "Something went wrong")
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/thedevsaddam/renderer"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// exportTodos streams every todo matching the listing filters as a JSON
+// array download, or as a Markdown checklist with format=markdown. JSON rows
+// are written as they are read so large exports never have to be held in
+// memory.
+func exportTodos(w http.ResponseWriter, r *http.Request) {
+	filter, err := todoFilter(r.URL.Query())
+	if err != nil {
+		badRequest(w, r, err)
+		return
+	}
+
+	sort, err := todoSort(r.URL.Query())
+	if err != nil {
+		badRequest(w, r, err)
+		return
+	}
+
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "json":
+	case "markdown":
+		exportMarkdown(w, r, filter, sort)
+		return
+	default:
+		rnd.JSON(w, http.StatusBadRequest, renderer.M{
+			"message": msg(r, "Invalid format"),
+		})
+		return
+	}
+
+	query := db.C(collectionName).Find(filter)
+	if cfg.maxResponseItems > 0 {
+		n, err := query.Count()
+		if err != nil {
+			rnd.JSON(w, http.StatusBadRequest, renderer.M{
+				"message": msg(r, "Failed to get todos"),
+				"error":   err,
+			})
+			return
+		}
+		if tooManyItems(w, r, n) {
+			return
+		}
+	}
+
+	iter := query.Sort(sort...).Iter()
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="todos.json"`)
+	w.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(w)
+	io.WriteString(w, "[")
+	var t todoModel
+	for n := 0; iter.Next(&t); n++ {
+		if n > 0 {
+			io.WriteString(w, ",")
+		}
+		if err := enc.Encode(toTodo(t)); err != nil {
+			break
+		}
+		t = todoModel{}
+	}
+	io.WriteString(w, "]")
+
+	// The status line is already sent, so a failure can only be logged.
+	if err := iter.Close(); err != nil {
+		requestLog(r).Println("Failed to export todos", err)
+	}
+}
+
+// exportMarkdown writes the todos as a Markdown checklist, optionally
+// grouped under a heading per completion state or per tag.
+func exportMarkdown(w http.ResponseWriter, r *http.Request, filter bson.M, sort []string) {
+	groupBy := r.URL.Query().Get("groupBy")
+	if groupBy != "" && groupBy != "completion" && groupBy != "tag" {
+		rnd.JSON(w, http.StatusBadRequest, renderer.M{
+			"message": msg(r, "Invalid groupBy"),
+		})
+		return
+	}
+
+	todos := []todoModel{}
+	if err := capItems(db.C(collectionName).Find(filter).Sort(sort...)).All(&todos); err != nil {
+		rnd.JSON(w, http.StatusBadRequest, renderer.M{
+			"message": msg(r, "Failed to get todos"),
+			"error":   err,
+		})
+		return
+	}
+	if tooManyItems(w, r, len(todos)) {
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString("# Todos\n")
+
+	groups, items := []string{""}, map[string][]todoModel{"": todos}
+	switch groupBy {
+	case "completion":
+		groups, items = []string{"Open", "Done"}, map[string][]todoModel{}
+		for _, t := range todos {
+			group := "Open"
+			if t.Completed {
+				group = "Done"
+			}
+			items[group] = append(items[group], t)
+		}
+	case "tag":
+		groups, items = []string{}, map[string][]todoModel{}
+		for _, t := range todos {
+			tags := t.Tags
+			if len(tags) == 0 {
+				tags = []string{"Untagged"}
+			}
+			for _, tag := range tags {
+				if _, ok := items[tag]; !ok {
+					groups = append(groups, tag)
+				}
+				items[tag] = append(items[tag], t)
+			}
+		}
+	}
+
+	for _, group := range groups {
+		b.WriteString("\n")
+		if group != "" {
+			fmt.Fprintf(&b, "## %s\n\n", group)
+		}
+		for _, t := range items[group] {
+			check := " "
+			if t.Completed {
+				check = "x"
+			}
+			fmt.Fprintf(&b, "- [%s] %s\n", check, strings.Join(strings.Fields(plainTitle(t)), " "))
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="todos.md"`)
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		requestLog(r).Println("Failed to export todos", err)
+	}
+}
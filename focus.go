@@ -0,0 +1,185 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thedevsaddam/renderer"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	defaultFocusLimit = 3
+
+	// dueSoonWindow is how close a due date has to be for a todo to
+	// count as due soon.
+	dueSoonWindow = 48 * time.Hour
+)
+
+// focusWeights weigh the parts of a todo's focus score.
+type focusWeights struct {
+	// priority is multiplied by 0, 1 or 2 for low, medium and high.
+	priority float64
+	// overdue is added for todos past their due date.
+	overdue float64
+	// dueSoon is added for todos due within dueSoonWindow.
+	dueSoon float64
+	// age is multiplied by the number of days since the todo was created.
+	age float64
+}
+
+var defaultFocusWeights = focusWeights{priority: 2, overdue: 3, dueSoon: 2, age: 0.1}
+
+var priorityRanks = map[string]float64{priorityLow: 0, priorityMedium: 1, priorityHigh: 2}
+
+// parseFocusWeights reads "name:weight" pairs over the default weights,
+// logging and skipping invalid ones.
+func parseFocusWeights(specs []string) focusWeights {
+	weights := defaultFocusWeights
+	fields := map[string]*float64{
+		"priority": &weights.priority,
+		"overdue":  &weights.overdue,
+		"dueSoon":  &weights.dueSoon,
+		"age":      &weights.age,
+	}
+	for _, spec := range specs {
+		name, value, _ := strings.Cut(spec, ":")
+		field, ok := fields[strings.TrimSpace(name)]
+		weight, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if !ok || err != nil {
+			log.Printf("Ignoring invalid focus weight %q", spec)
+			continue
+		}
+		*field = weight
+	}
+	return weights
+}
+
+// focusScore is the aggregation expression that ranks how urgently a todo
+// should be worked on at now.
+func focusScore(weights focusWeights, now time.Time) bson.M {
+	hasDueDate := bson.M{"$eq": []interface{}{bson.M{"$type": "$dueDate"}, "date"}}
+	due := bson.M{"$cond": []interface{}{
+		bson.M{"$and": []interface{}{hasDueDate, bson.M{"$lt": []interface{}{"$dueDate", now}}}},
+		weights.overdue,
+		bson.M{"$cond": []interface{}{
+			bson.M{"$and": []interface{}{hasDueDate, bson.M{"$lte": []interface{}{"$dueDate", now.Add(dueSoonWindow)}}}},
+			weights.dueSoon,
+			0,
+		}},
+	}}
+
+	// Todos without a priority count as medium.
+	priority := bson.M{"$switch": bson.M{
+		"branches": []bson.M{
+			{"case": bson.M{"$eq": []interface{}{"$priority", priorityLow}}, "then": priorityRanks[priorityLow]},
+			{"case": bson.M{"$eq": []interface{}{"$priority", priorityHigh}}, "then": priorityRanks[priorityHigh]},
+		},
+		"default": priorityRanks[priorityMedium],
+	}}
+
+	days := bson.M{"$divide": []interface{}{bson.M{"$subtract": []interface{}{now, "$createdAt"}}, float64(24 * time.Hour / time.Millisecond)}}
+
+	return bson.M{"$add": []interface{}{
+		bson.M{"$multiply": []interface{}{weights.priority, priority}},
+		due,
+		bson.M{"$multiply": []interface{}{weights.age, days}},
+	}}
+}
+
+// focusTodos returns the incomplete todos most worth working on next,
+// highest score first. Todos scheduled to start later are left out.
+func focusTodos(w http.ResponseWriter, r *http.Request) {
+	limit := defaultFocusLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPageSize {
+			rnd.JSON(w, http.StatusBadRequest, renderer.M{
+				"message": msg(r, "Invalid limit"),
+			})
+			return
+		}
+		limit = n
+	}
+
+	q := url.Values{}
+	for key, values := range r.URL.Query() {
+		q[key] = values
+	}
+	q.Set("completed", "false")
+	q.Del("includeScheduled")
+
+	filter, err := todoFilter(q)
+	if err != nil {
+		badRequest(w, r, err)
+		return
+	}
+
+	// Scoring in the database keeps only the top todos in memory, however
+	// many are open. Equal scores keep the oldest todo first.
+	type scoredTodo struct {
+		todoModel `bson:",inline"`
+		Score     float64 `bson:"focusScore"`
+	}
+	scored := []scoredTodo{}
+	if err := db.C(collectionName).Pipe([]bson.M{
+		{"$match": filter},
+		{"$addFields": bson.M{"focusScore": focusScore(cfg.focusWeights, time.Now())}},
+		{"$sort": bson.D{{Name: "focusScore", Value: -1}, {Name: "createdAt", Value: 1}, {Name: "_id", Value: 1}}},
+		{"$limit": limit},
+	}).All(&scored); err != nil {
+		rnd.JSON(w, http.StatusBadRequest, renderer.M{
+			"message": msg(r, "Failed to get todos"),
+			"error":   err,
+		})
+		return
+	}
+
+	type focusedTodo struct {
+		todo
+		Score float64 `json:"score"`
+	}
+	focused := []focusedTodo{}
+	for _, t := range scored {
+		focused = append(focused, focusedTodo{todo: toTodo(t.todoModel), Score: t.Score})
+	}
+
+	rnd.JSON(w, http.StatusOK, renderer.M{
+		"data": focused,
+	})
+}
+
+// nextDueTodo returns the incomplete todo with the soonest due date that
+// hasn't passed yet, or 404 when no todo is due.
+func nextDueTodo(w http.ResponseWriter, r *http.Request) {
+	filter, err := todoFilter(url.Values{"completed": {"false"}})
+	if err != nil {
+		badRequest(w, r, err)
+		return
+	}
+	addCondition(filter, bson.M{"dueDate": bson.M{"$gte": time.Now()}})
+
+	var t todoModel
+	if err := db.C(collectionName).Find(filter).Sort("dueDate", "_id").One(&t); err != nil {
+		if err == mgo.ErrNotFound {
+			rnd.JSON(w, http.StatusNotFound, renderer.M{
+				"message": msg(r, "No todo is due"),
+			})
+			return
+		}
+		rnd.JSON(w, http.StatusBadRequest, renderer.M{
+			"message": msg(r, "Failed to get todo"),
+			"error":   err,
+		})
+		return
+	}
+
+	rnd.JSON(w, http.StatusOK, renderer.M{
+		"data": toTodo(t),
+	})
+}
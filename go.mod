@@ -3,8 +3,10 @@ module github.com/techatikin/todo-app
 go 1.19
 
 require (
-	github.com/go-chi/chi v1.5.4 // indirect
-	github.com/thedevsaddam/renderer v1.2.0 // indirect
-	gopkg.in/mgo.v2 v2.0.0-20190816093944-a6b53ec6cb22 // indirect
-	gopkg.in/yaml.v2 v2.4.0 // indirect
+	github.com/go-chi/chi v1.5.4
+	github.com/graph-gophers/graphql-go v1.7.2
+	github.com/thedevsaddam/renderer v1.2.0
+	gopkg.in/mgo.v2 v2.0.0-20190816093944-a6b53ec6cb22
 )
+
+require gopkg.in/yaml.v2 v2.4.0 // indirect
@@ -0,0 +1,511 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+
+	graphql "github.com/graph-gophers/graphql-go"
+	"github.com/thedevsaddam/renderer"
+)
+
+// /graphql serves the todo store over GraphQL for clients that want to pick
+// the fields they get back. Queries and mutations go through the same store
+// functions, and so the same validation, as the REST handlers.
+
+const (
+	// maxGraphQLBodyBytes bounds the size of a POST /graphql body.
+	maxGraphQLBodyBytes = 1 << 20
+	// maxGraphQLQueryBytes bounds the length of a GraphQL document, which
+	// also bounds how deeply its values can nest.
+	maxGraphQLQueryBytes = 64 << 10
+	// maxGraphQLDepth bounds how deeply fields may be selected.
+	maxGraphQLDepth = 8
+)
+
+const gqlTypes = `
+type TodoPage {
+	data: [Todo!]!
+	total: Int!
+	offset: Int!
+	limit: Int!
+}
+
+type Subtask {
+	title: String!
+	completed: Boolean!
+}
+
+type Todo {
+	id: ID!
+	title: String!
+	description: String
+	completed: Boolean!
+	status: String!
+	position: Float!
+	seq: Int!
+	startAt: String
+	dueDate: String
+	reminders: [String!]!
+	tags: [String!]!
+	priority: String
+	subtasks: [Subtask!]!
+	parentId: ID
+	progress: Int!
+	nextAction: String
+	completedAt: String
+	completedReason: String
+	archived: Boolean!
+	archivedAt: String
+	owner: String
+	lastUpdatedBy: String
+	claimedBy: String
+	claimedAt: String
+	createdAt: String!
+	updatedAt: String!
+	hash: String!
+}
+
+type Query {
+	todos(
+		q: String, status: String, completed: Boolean, priority: String, tag: String,
+		completedFrom: String, completedTo: String, sinceSeq: Int, titleLongerThan: Int,
+		hasDescription: Boolean, archived: Boolean, includeScheduled: Boolean,
+		sort: String, offset: Int, limit: Int
+	): TodoPage!
+	todo(id: ID!): Todo
+}
+`
+
+const gqlMutationTypes = `
+input SubtaskInput {
+	title: String!
+	completed: Boolean
+}
+
+input TodoInput {
+	title: String!
+	description: String
+	status: String
+	priority: String
+	tags: [String!]
+	subtasks: [SubtaskInput!]
+	startAt: String
+	dueDate: String
+	reminders: [String!]
+	parentId: String
+	owner: String
+}
+
+input TodoPatch {
+	title: String
+	description: String
+	status: String
+	completed: Boolean
+	priority: String
+	tags: [String!]
+	subtasks: [SubtaskInput!]
+	startAt: String
+	dueDate: String
+	reminders: [String!]
+	parentId: String
+	archived: Boolean
+}
+
+type Mutation {
+	createTodo(input: TodoInput!): Todo
+	updateTodo(id: ID!, input: TodoPatch!): Todo
+	deleteTodo(id: ID!, children: String): Todo
+	toggleTodo(id: ID!): Todo
+}
+`
+
+var gqlOptions = []graphql.SchemaOpt{
+	graphql.UseFieldResolvers(),
+	graphql.MaxQueryLength(maxGraphQLQueryBytes),
+	graphql.MaxDepth(maxGraphQLDepth),
+}
+
+var (
+	// gqlSchema serves POST requests. gqlQuerySchema has no mutations and
+	// serves GET, so every write is subject to read-only windows.
+	gqlSchema      = graphql.MustParseSchema("schema { query: Query mutation: Mutation }"+gqlTypes+gqlMutationTypes, &gqlResolver{}, gqlOptions...)
+	gqlQuerySchema = graphql.MustParseSchema("schema { query: Query }"+gqlTypes, &gqlResolver{}, gqlOptions...)
+)
+
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// gqlCall is the request a GraphQL operation runs for, collecting the
+// warnings of its mutations.
+type gqlCall struct {
+	w        http.ResponseWriter
+	r        *http.Request
+	warnings []string
+}
+
+type gqlCallKey struct{}
+
+func callFrom(ctx context.Context) *gqlCall {
+	return ctx.Value(gqlCallKey{}).(*gqlCall)
+}
+
+// graphqlHandler runs a GraphQL operation sent as a JSON body with POST, or
+// as the query, operationName and variables parameters with GET. GET only
+// runs queries.
+func graphqlHandler(w http.ResponseWriter, r *http.Request) {
+	var req graphqlRequest
+	schema := gqlSchema
+	if r.Method == http.MethodGet {
+		schema = gqlQuerySchema
+		q := r.URL.Query()
+		req.Query, req.OperationName = q.Get("query"), q.Get("operationName")
+		if v := q.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				rnd.JSON(w, http.StatusBadRequest, renderer.M{
+					"message": msg(r, "Invalid request body"),
+				})
+				return
+			}
+		}
+	} else {
+		r.Body = http.MaxBytesReader(w, r.Body, maxGraphQLBodyBytes)
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				rnd.JSON(w, http.StatusRequestEntityTooLarge, renderer.M{
+					"message": msg(r, "Request body too large"),
+				})
+				return
+			}
+			rnd.JSON(w, http.StatusBadRequest, renderer.M{
+				"message": msg(r, "Invalid request body"),
+			})
+			return
+		}
+	}
+
+	call := &gqlCall{w: w, r: r}
+	response := schema.Exec(context.WithValue(r.Context(), gqlCallKey{}, call), req.Query, req.OperationName, req.Variables)
+	if len(call.warnings) > 0 {
+		response.Extensions = map[string]interface{}{"warnings": call.warnings}
+	}
+
+	// Operations that didn't run at all, because they couldn't be parsed
+	// or validated, are the client's mistake.
+	status := http.StatusOK
+	if response.Data == nil && len(response.Errors) > 0 {
+		status = http.StatusBadRequest
+	}
+	rnd.JSON(w, status, response)
+}
+
+type gqlResolver struct{}
+
+type gqlPage struct {
+	Data   []*gqlTodo
+	Total  int32
+	Offset int32
+	Limit  int32
+}
+
+// gqlTodo is a todo as rendered by toTodo, with the optional fields left
+// null instead of empty.
+type gqlTodo struct {
+	ID              graphql.ID
+	Title           string
+	Description     *string
+	Completed       bool
+	Status          string
+	Position        float64
+	Seq             int32
+	StartAt         *string
+	DueDate         *string
+	Reminders       []string
+	Tags            []string
+	Priority        *string
+	Subtasks        []subtask
+	ParentID        *graphql.ID
+	Progress        int32
+	NextAction      *string
+	CompletedAt     *string
+	CompletedReason *string
+	Archived        bool
+	ArchivedAt      *string
+	Owner           *string
+	LastUpdatedBy   *string
+	ClaimedBy       *string
+	ClaimedAt       *string
+	CreatedAt       string
+	UpdatedAt       string
+	Hash            string
+}
+
+func toGQLTodo(rendered todo) *gqlTodo {
+	g := &gqlTodo{
+		ID:              graphql.ID(rendered.ID),
+		Title:           rendered.Title,
+		Description:     rendered.Description,
+		Completed:       rendered.Completed,
+		Status:          rendered.Status,
+		Position:        rendered.Position,
+		Seq:             int32(rendered.Seq),
+		StartAt:         optionalString(rendered.StartAt),
+		DueDate:         optionalString(rendered.DueDate),
+		Reminders:       rendered.Reminders,
+		Tags:            rendered.Tags,
+		Priority:        optionalString(rendered.Priority),
+		Subtasks:        rendered.Subtasks,
+		Progress:        int32(rendered.Progress),
+		NextAction:      optionalString(rendered.NextAction),
+		CompletedAt:     optionalString(rendered.CompletedAt),
+		CompletedReason: optionalString(rendered.CompletedReason),
+		Archived:        rendered.Archived,
+		ArchivedAt:      optionalString(rendered.ArchivedAt),
+		Owner:           optionalString(rendered.Owner),
+		LastUpdatedBy:   optionalString(rendered.LastUpdatedBy),
+		ClaimedBy:       optionalString(rendered.ClaimedBy),
+		ClaimedAt:       optionalString(rendered.ClaimedAt),
+		CreatedAt:       rendered.CreatedAt,
+		UpdatedAt:       rendered.UpdatedAt,
+		Hash:            rendered.Hash,
+	}
+	if rendered.ParentID != "" {
+		parent := graphql.ID(rendered.ParentID)
+		g.ParentID = &parent
+	}
+	return g
+}
+
+// gqlListArgs are the listing parameters of GET /todo, plus offset and
+// limit. Arguments left out stay nil.
+type gqlListArgs struct {
+	Q                *string
+	Status           *string
+	Completed        *bool
+	Priority         *string
+	Tag              *string
+	CompletedFrom    *string
+	CompletedTo      *string
+	SinceSeq         *int32
+	TitleLongerThan  *int32
+	HasDescription   *bool
+	Archived         *bool
+	IncludeScheduled *bool
+	Sort             *string
+	Offset           *int32
+	Limit            *int32
+}
+
+// values turns the arguments into the query parameters they stand for.
+func (a gqlListArgs) values() url.Values {
+	q := url.Values{}
+	v := reflect.ValueOf(a)
+	for i := 0; i < v.NumField(); i++ {
+		if arg := v.Field(i); !arg.IsNil() {
+			name := v.Type().Field(i).Name
+			q.Set(strings.ToLower(name[:1])+name[1:], fmt.Sprint(arg.Elem().Interface()))
+		}
+	}
+	return q
+}
+
+func (*gqlResolver) Todos(ctx context.Context, args gqlListArgs) (*gqlPage, error) {
+	listed, err := listTodos(args.values())
+	if err != nil {
+		return nil, gqlFailure(ctx, err)
+	}
+	page := &gqlPage{Data: []*gqlTodo{}, Total: int32(listed.Total), Offset: int32(listed.Offset), Limit: int32(listed.Limit)}
+	for _, t := range listed.Data {
+		page.Data = append(page.Data, toGQLTodo(t))
+	}
+	return page, nil
+}
+
+func (*gqlResolver) Todo(ctx context.Context, args struct{ ID graphql.ID }) (*gqlTodo, error) {
+	return gqlResult(ctx)(findTodo(string(args.ID)))
+}
+
+type gqlSubtaskInput struct {
+	Title     string
+	Completed *bool
+}
+
+type gqlTodoInput struct {
+	Title       string
+	Description *string
+	Status      *string
+	Priority    *string
+	Tags        *[]string
+	Subtasks    *[]gqlSubtaskInput
+	StartAt     *string
+	DueDate     *string
+	Reminders   *[]string
+	ParentID    *string
+	Owner       *string
+}
+
+type gqlTodoPatch struct {
+	Title       *string
+	Description *string
+	Status      *string
+	Completed   *bool
+	Priority    *string
+	Tags        *[]string
+	Subtasks    *[]gqlSubtaskInput
+	StartAt     *string
+	DueDate     *string
+	Reminders   *[]string
+	ParentID    *string
+	Archived    *bool
+}
+
+func subtasksFrom(inputs []gqlSubtaskInput) []subtask {
+	subtasks := []subtask{}
+	for _, in := range inputs {
+		subtasks = append(subtasks, subtask{Title: in.Title, Completed: in.Completed != nil && *in.Completed})
+	}
+	return subtasks
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func (*gqlResolver) CreateTodo(ctx context.Context, args struct{ Input gqlTodoInput }) (*gqlTodo, error) {
+	in := args.Input
+	t := todo{
+		Title:       in.Title,
+		Description: in.Description,
+		Status:      deref(in.Status),
+		Priority:    deref(in.Priority),
+		StartAt:     deref(in.StartAt),
+		DueDate:     deref(in.DueDate),
+		ParentID:    deref(in.ParentID),
+		Owner:       deref(in.Owner),
+	}
+	// Default tags only apply when tags are left out.
+	if in.Tags != nil {
+		t.Tags = *in.Tags
+	}
+	if in.Subtasks != nil {
+		t.Subtasks = subtasksFrom(*in.Subtasks)
+	}
+	if in.Reminders != nil {
+		t.Reminders = *in.Reminders
+	}
+
+	call := callFrom(ctx)
+	created, owned, err := addTodo(t, call.r)
+	if err != nil {
+		return nil, gqlFailure(ctx, err)
+	}
+	call.warnings = append(call.warnings, warn(call.w, call.r, limitWarnings(created, owned+1))...)
+	return toGQLTodo(toTodo(created)), nil
+}
+
+func (*gqlResolver) UpdateTodo(ctx context.Context, args struct {
+	ID    graphql.ID
+	Input gqlTodoPatch
+}) (*gqlTodo, error) {
+	in := args.Input
+	p := todoPatch{
+		Title:       in.Title,
+		Description: in.Description,
+		Status:      in.Status,
+		Completed:   in.Completed,
+		Priority:    in.Priority,
+		Tags:        in.Tags,
+		StartAt:     in.StartAt,
+		DueDate:     in.DueDate,
+		Reminders:   in.Reminders,
+		ParentID:    in.ParentID,
+		Archived:    in.Archived,
+	}
+	if in.Subtasks != nil {
+		subtasks := subtasksFrom(*in.Subtasks)
+		p.Subtasks = &subtasks
+	}
+	return gqlResult(ctx)(changeTodo(string(args.ID), callFrom(ctx).r, func(todoModel) todoPatch { return p }))
+}
+
+func (*gqlResolver) DeleteTodo(ctx context.Context, args struct {
+	ID       graphql.ID
+	Children *string
+}) (*gqlTodo, error) {
+	cascade, err := childrenMode(deref(args.Children))
+	if err != nil {
+		return nil, gqlFailure(ctx, err)
+	}
+	return gqlResult(ctx)(removeTodo(string(args.ID), cascade))
+}
+
+func (*gqlResolver) ToggleTodo(ctx context.Context, args struct{ ID graphql.ID }) (*gqlTodo, error) {
+	return gqlResult(ctx)(toggleTodo(string(args.ID), callFrom(ctx).r))
+}
+
+// gqlResult renders the todo returned by a store function, or its error.
+func gqlResult(ctx context.Context) func(todoModel, error) (*gqlTodo, error) {
+	return func(t todoModel, err error) (*gqlTodo, error) {
+		if err != nil {
+			return nil, gqlFailure(ctx, err)
+		}
+		return toGQLTodo(toTodo(t)), nil
+	}
+}
+
+// gqlError is a resolver error with the translated message and the extra
+// details the REST API puts in its response.
+type gqlError struct {
+	message    string
+	extensions map[string]interface{}
+}
+
+func (e *gqlError) Error() string { return e.message }
+
+func (e *gqlError) Extensions() map[string]interface{} { return e.extensions }
+
+// gqlFailure reports an error from the todo store to a GraphQL client.
+func gqlFailure(ctx context.Context, err error) error {
+	r := callFrom(ctx).r
+	var failed *storeError
+	var duplicate *duplicateError
+	var invalid validationErrors
+	switch {
+	case errors.As(err, &failed):
+		if isWriteConcernError(failed.err) {
+			return &gqlError{message: msg(r, "Write not durable")}
+		}
+	case err == errOwnerLimit:
+		return &gqlError{message: msg(r, err.Error()), extensions: map[string]interface{}{"limit": cfg.maxTodosPerOwner}}
+	case errors.As(err, &duplicate):
+		return &gqlError{message: msg(r, err.Error()), extensions: map[string]interface{}{"id": duplicate.id.Hex()}}
+	case errors.As(err, &invalid):
+		extensions := map[string]interface{}{}
+		errs := map[string]string{}
+		for field, reason := range invalid {
+			if reason == (&dateError{field: field}).Error() {
+				extensions["acceptedFormats"] = dateExamples()
+			}
+			errs[field] = msg(r, reason)
+		}
+		extensions["errors"] = errs
+		return &gqlError{message: msg(r, err.Error()), extensions: extensions}
+	}
+
+	if _, ok := err.(*dateError); ok {
+		return &gqlError{message: msg(r, err.Error()), extensions: map[string]interface{}{"acceptedFormats": dateExamples()}}
+	}
+	return &gqlError{message: msg(r, err.Error())}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func graphqlBody(query string) string {
+	body, _ := json.Marshal(graphqlRequest{Query: query})
+	return string(body)
+}
+
+func TestGraphQLRejectsOversizedInput(t *testing.T) {
+	tests := []struct {
+		name, body string
+		status     int
+	}{
+		{"deeply nested value", graphqlBody(`{ todos(q: ` + strings.Repeat("[", 50000) + `) { total } }`), http.StatusBadRequest},
+		{"long query", graphqlBody(`{ todos(q: ` + strings.Repeat("[", maxGraphQLQueryBytes) + `) { total } }`), http.StatusBadRequest},
+		{"large body", graphqlBody(`{ todos(q: ` + strings.Repeat("[", 8<<20) + `) { total } }`), http.StatusRequestEntityTooLarge},
+		{"deep selection", graphqlBody(`{ __schema { types { fields { type { ofType { ofType { ofType { ofType { ofType { name } } } } } } } } } }`), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		graphqlHandler(w, httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(tt.body)))
+		if w.Code != tt.status {
+			t.Errorf("%s: status %d, want %d: %s", tt.name, w.Code, tt.status, w.Body.String())
+		}
+	}
+}
+
+func TestGraphQLValidation(t *testing.T) {
+	tests := []struct {
+		method, query string
+		status        int
+	}{
+		{http.MethodPost, `{ __schema { queryType { name } mutationType { name } } }`, http.StatusOK},
+		{http.MethodPost, `{ todos { color } }`, http.StatusBadRequest},
+		{http.MethodPost, `mutation { toggleTodo { id } }`, http.StatusBadRequest},
+		{http.MethodPost, `mutation($id: ID!) { toggleTodo(id: $id) { id } }`, http.StatusBadRequest},
+		{http.MethodGet, `mutation { toggleTodo(id: "x") { id } }`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		var r *http.Request
+		if tt.method == http.MethodGet {
+			r = httptest.NewRequest(tt.method, "/graphql?query="+strings.ReplaceAll(tt.query, " ", "+"), nil)
+		} else {
+			r = httptest.NewRequest(tt.method, "/graphql", strings.NewReader(graphqlBody(tt.query)))
+		}
+		w := httptest.NewRecorder()
+		graphqlHandler(w, r)
+		if w.Code != tt.status {
+			t.Errorf("%s %s: status %d, want %d: %s", tt.method, tt.query, w.Code, tt.status, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// todoHash is a fingerprint of the fields a client cache cares about: the
+// plaintext title, completed and updatedAt. Every change to a todo stamps
+// updatedAt, so the hash changes whenever the todo does, and it is the
+// same whether or not the stored title is encrypted.
+func todoHash(t todoModel) string {
+	h := sha256.New()
+	h.Write([]byte(plainTitle(t)))
+	h.Write([]byte{0})
+	h.Write([]byte(strconv.FormatBool(t.Completed)))
+	h.Write([]byte{0})
+	h.Write([]byte(strconv.FormatInt(t.UpdatedAt.UnixNano(), 10)))
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// notModified sets the ETag for a todo with the given hash and reports
+// whether the request's If-None-Match already names it, in which case a
+// 304 has been written.
+func notModified(w http.ResponseWriter, r *http.Request, hash string) bool {
+	etag := `"` + hash + `"`
+	w.Header().Set("ETag", etag)
+
+	for _, candidate := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// dedupeCollectionName holds a marker per recently created content, so
+// duplicate creates can be told apart atomically.
+const dedupeCollectionName = "dedupe"
+
+type dedupeMarker struct {
+	ID     string        `bson:"_id"`
+	TodoID bson.ObjectId `bson:"todoId"`
+	At     time.Time     `bson:"at"`
+}
+
+// contentHash identifies a todo's content for duplicate detection: its
+// owner, title and description with case and whitespace differences
+// ignored. With a title key configured it is an HMAC keyed by contentKey.
+func contentHash(t todoModel) string {
+	normalize := func(s string) string {
+		return strings.ToLower(strings.Join(strings.Fields(s), " "))
+	}
+	h := sha256.New()
+	if contentKey != nil {
+		h = hmac.New(sha256.New, contentKey)
+	}
+	h.Write([]byte(t.Owner))
+	h.Write([]byte{0})
+	h.Write([]byte(normalize(t.Title)))
+	h.Write([]byte{0})
+	h.Write([]byte(normalize(t.Description)))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// claimContent records that t, whose id must already be assigned, is
+// being created. If the same content was claimed within the dedupe
+// window it returns the id of the todo that claimed it instead. The
+// marker's id is the content hash, so of two concurrent creates only one
+// can write it: the other's upsert fails with a duplicate key.
+func claimContent(t todoModel) (bson.ObjectId, error) {
+	key := contentHash(t)
+	now := time.Now()
+	err := applyChange(db.C(dedupeCollectionName), bson.M{
+		"_id": key,
+		"at":  bson.M{"$lt": now.Add(-cfg.dedupeWindow)},
+	}, mgo.Change{
+		Update: bson.M{"$set": bson.M{"todoId": t.ID, "at": now}},
+		Upsert: true,
+	}, nil)
+	if !mgo.IsDup(err) {
+		return "", err
+	}
+
+	var marker dedupeMarker
+	if err := db.C(dedupeCollectionName).FindId(key).One(&marker); err != nil {
+		return "", err
+	}
+	return marker.TodoID, nil
+}
+
+// releaseContent drops the dedupe markers of todos, when their create
+// failed, their title or description changed or they were deleted, so
+// they no longer match creates of the content they had.
+func releaseContent(ids ...bson.ObjectId) {
+	if cfg.dedupeWindow <= 0 || len(ids) == 0 {
+		return
+	}
+	if _, err := db.C(dedupeCollectionName).RemoveAll(bson.M{"todoId": bson.M{"$in": ids}}); err != nil {
+		log.Println("Failed to release dedupe markers of todos", ids, err)
+	}
+}
+
+// releaseChangedContent releases the markers of current when an update
+// to it changes its title or description. Titles are only set when they
+// change.
+func releaseChangedContent(current todoModel, set, unset bson.M) {
+	_, title := set["title"]
+	description, setDescription := set["description"]
+	_, unsetDescription := unset["description"]
+	if title || (setDescription && description != current.Description) || (unsetDescription && current.Description != "") {
+		releaseContent(current.ID)
+	}
+}
+
+// ensureDedupeIndex lets MongoDB expire old markers. Markers are only
+// matched within the window anyway, so a failure is logged, not fatal.
+func ensureDedupeIndex() {
+	err := db.C(dedupeCollectionName).EnsureIndex(mgo.Index{
+		Key:         []string{"at"},
+		ExpireAfter: cfg.dedupeWindow + time.Minute,
+	})
+	if err != nil {
+		log.Println("Failed to create dedupe marker index", err)
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// messages translates the English response messages, keyed by language and
+// then by the English text. Messages missing from a catalog fall back to
+// English.
+var messages = map[string]map[string]string{
+	"es": {
+		"A tag cannot be both added and removed":             "Una etiqueta no se puede añadir y quitar a la vez",
+		"A todo cannot be its own ancestor":                  "Una tarea no puede ser su propio ancestro",
+		"A todo cannot be its own parent":                    "Una tarea no puede ser su propia tarea padre",
+		"A todo cannot be moved relative to itself":          "Una tarea no se puede mover respecto a sí misma",
+		"A user is required to claim todos":                  "Se necesita un usuario para reclamar tareas",
+		"Admin API is disabled":                              "La API de administración está desactivada",
+		"CSV needs a title column":                           "El CSV necesita una columna title",
+		"Duplicate todo":                                     "Tarea duplicada",
+		"Failed to claim todo":                               "No se pudo reclamar la tarea",
+		"Failed to create todo":                              "No se pudo crear la tarea",
+		"Failed to delete todo":                              "No se pudo eliminar la tarea",
+		"Failed to get reminders":                            "No se pudieron obtener los recordatorios",
+		"Failed to get todo":                                 "No se pudo obtener la tarea",
+		"Failed to get todos":                                "No se pudieron obtener las tareas",
+		"Failed to move todo":                                "No se pudo mover la tarea",
+		"Failed to rank todo":                                "No se pudo calcular la posición de la tarea",
+		"Failed to touch todo":                               "No se pudo actualizar la tarea",
+		"Failed to update tags":                              "No se pudieron actualizar las etiquetas",
+		"Failed to update todo":                              "No se pudo actualizar la tarea",
+		"Failed to update todos":                             "No se pudieron actualizar las tareas",
+		"Invalid archived":                                   "Valor de archived no válido",
+		"Invalid children":                                   "Valor de children no válido",
+		"Invalid completed":                                  "Valor de completed no válido",
+		"Invalid completedFrom":                              "Valor de completedFrom no válido",
+		"Invalid completedTo":                                "Valor de completedTo no válido",
+		"Invalid dueDate":                                    "Fecha de vencimiento no válida",
+		"Invalid format":                                     "Formato no válido",
+		"Invalid groupBy":                                    "Valor de groupBy no válido",
+		"Invalid hasDescription":                             "Valor de hasDescription no válido",
+		"Invalid id":                                         "Id no válido",
+		"Invalid includeScheduled":                           "Valor de includeScheduled no válido",
+		"Invalid limit":                                      "Límite no válido",
+		"Invalid offset":                                     "Desplazamiento no válido",
+		"Invalid parentId":                                   "Tarea padre no válida",
+		"Invalid priority":                                   "Prioridad no válida",
+		"Invalid query parameter":                            "Parámetro de consulta no válido",
+		"Invalid reminders":                                  "Recordatorios no válidos",
+		"Invalid request body":                               "Cuerpo de la solicitud no válido",
+		"Invalid sinceSeq":                                   "Valor de sinceSeq no válido",
+		"Invalid sort":                                       "Orden no válido",
+		"Invalid startAt":                                    "Fecha de inicio no válida",
+		"Invalid status":                                     "Estado no válido",
+		"Invalid tag":                                        "Etiqueta no válida",
+		"Invalid titleLongerThan":                            "Valor de titleLongerThan no válido",
+		"Invalid view":                                       "Vista no válida",
+		"No todo is due":                                     "No hay tareas pendientes de vencimiento",
+		"Owner is close to the todo limit":                   "El propietario está cerca del límite de tareas",
+		"Page not found":                                     "Página no encontrada",
+		"Parent todo not found":                              "Tarea padre no encontrada",
+		"Request body too large":                             "Cuerpo de la solicitud demasiado grande",
+		"Server is busy, try again later":                    "El servidor está ocupado, inténtalo más tarde",
+		"Something went wrong":                               "Algo salió mal",
+		"Subtask title is required":                          "El título de la subtarea es obligatorio",
+		"Tags updated successfully":                          "Etiquetas actualizadas correctamente",
+		"Target todo not found":                              "Tarea de destino no encontrada",
+		"The server is read-only for maintenance":            "El servidor está en modo de solo lectura por mantenimiento",
+		"Title is required":                                  "El título es obligatorio",
+		"Title is too long":                                  "El título es demasiado largo",
+		"Todo claimed successfully":                          "Tarea reclamada correctamente",
+		"Todo created successfully":                          "Tarea creada correctamente",
+		"Todo deleted but its subtodos could not be updated": "Tarea eliminada, pero no se pudieron actualizar sus subtareas",
+		"Todo deleted successfully":                          "Tarea eliminada correctamente",
+		"Todo is close to the tag limit":                     "La tarea está cerca del límite de etiquetas",
+		"Todo limit reached":                                 "Se alcanzó el límite de tareas",
+		"Todo moved successfully":                            "Tarea movida correctamente",
+		"Todo not found":                                     "Tarea no encontrada",
+		"Todo touched successfully":                          "Tarea marcada como reciente",
+		"Todo updated successfully":                          "Tarea actualizada correctamente",
+		"Todo was deleted":                                   "La tarea fue eliminada",
+		"Todos updated successfully":                         "Tareas actualizadas correctamente",
+		"Too many queries":                                   "Demasiadas consultas",
+		"Too many reminders":                                 "Demasiados recordatorios",
+		"Too many tags":                                      "Demasiadas etiquetas",
+		"Too many todos":                                     "Demasiadas tareas",
+		"Too many todos match, narrow the filters":           "Demasiadas tareas coinciden, restringe los filtros",
+		"Unauthorized":                                       "No autorizado",
+		"User-Agent header is required":                      "La cabecera User-Agent es obligatoria",
+		"Validation failed":                                  "La validación falló",
+		"Write not durable":                                  "La escritura no es duradera",
+		"ids are required":                                   "Los ids son obligatorios",
+		"owner is required":                                  "El propietario es obligatorio",
+	},
+	"fr": {
+		"A tag cannot be both added and removed":             "Une étiquette ne peut pas être ajoutée et retirée à la fois",
+		"A todo cannot be its own ancestor":                  "Une tâche ne peut pas être son propre ancêtre",
+		"A todo cannot be its own parent":                    "Une tâche ne peut pas être sa propre tâche parente",
+		"A todo cannot be moved relative to itself":          "Une tâche ne peut pas être déplacée par rapport à elle-même",
+		"A user is required to claim todos":                  "Un utilisateur est requis pour réclamer des tâches",
+		"Admin API is disabled":                              "L'API d'administration est désactivée",
+		"CSV needs a title column":                           "Le CSV doit avoir une colonne title",
+		"Duplicate todo":                                     "Tâche en double",
+		"Failed to claim todo":                               "Impossible de réclamer la tâche",
+		"Failed to create todo":                              "Impossible de créer la tâche",
+		"Failed to delete todo":                              "Impossible de supprimer la tâche",
+		"Failed to get reminders":                            "Impossible de récupérer les rappels",
+		"Failed to get todo":                                 "Impossible de récupérer la tâche",
+		"Failed to get todos":                                "Impossible de récupérer les tâches",
+		"Failed to move todo":                                "Impossible de déplacer la tâche",
+		"Failed to rank todo":                                "Impossible de calculer le rang de la tâche",
+		"Failed to touch todo":                               "Impossible de rafraîchir la tâche",
+		"Failed to update tags":                              "Impossible de mettre à jour les étiquettes",
+		"Failed to update todo":                              "Impossible de mettre à jour la tâche",
+		"Failed to update todos":                             "Impossible de mettre à jour les tâches",
+		"Invalid archived":                                   "Valeur de archived invalide",
+		"Invalid children":                                   "Valeur de children invalide",
+		"Invalid completed":                                  "Valeur de completed invalide",
+		"Invalid completedFrom":                              "Valeur de completedFrom invalide",
+		"Invalid completedTo":                                "Valeur de completedTo invalide",
+		"Invalid dueDate":                                    "Date d'échéance invalide",
+		"Invalid format":                                     "Format invalide",
+		"Invalid groupBy":                                    "Valeur de groupBy invalide",
+		"Invalid hasDescription":                             "Valeur de hasDescription invalide",
+		"Invalid id":                                         "Identifiant invalide",
+		"Invalid includeScheduled":                           "Valeur de includeScheduled invalide",
+		"Invalid limit":                                      "Limite invalide",
+		"Invalid offset":                                     "Décalage invalide",
+		"Invalid parentId":                                   "Tâche parente invalide",
+		"Invalid priority":                                   "Priorité invalide",
+		"Invalid query parameter":                            "Paramètre de requête invalide",
+		"Invalid reminders":                                  "Rappels invalides",
+		"Invalid request body":                               "Corps de requête invalide",
+		"Invalid sinceSeq":                                   "Valeur de sinceSeq invalide",
+		"Invalid sort":                                       "Tri invalide",
+		"Invalid startAt":                                    "Date de début invalide",
+		"Invalid status":                                     "Statut invalide",
+		"Invalid tag":                                        "Étiquette invalide",
+		"Invalid titleLongerThan":                            "Valeur de titleLongerThan invalide",
+		"Invalid view":                                       "Vue invalide",
+		"No todo is due":                                     "Aucune tâche n'est à échéance",
+		"Owner is close to the todo limit":                   "Le propriétaire approche de la limite de tâches",
+		"Page not found":                                     "Page introuvable",
+		"Parent todo not found":                              "Tâche parente introuvable",
+		"Request body too large":                             "Corps de requête trop volumineux",
+		"Server is busy, try again later":                    "Le serveur est occupé, réessayez plus tard",
+		"Something went wrong":                               "Une erreur est survenue",
+		"Subtask title is required":                          "Le titre de la sous-tâche est obligatoire",
+		"Tags updated successfully":                          "Étiquettes mises à jour",
+		"Target todo not found":                              "Tâche cible introuvable",
+		"The server is read-only for maintenance":            "Le serveur est en lecture seule pour maintenance",
+		"Title is required":                                  "Le titre est obligatoire",
+		"Title is too long":                                  "Le titre est trop long",
+		"Todo claimed successfully":                          "Tâche réclamée",
+		"Todo created successfully":                          "Tâche créée",
+		"Todo deleted but its subtodos could not be updated": "Tâche supprimée, mais ses sous-tâches n'ont pas pu être mises à jour",
+		"Todo deleted successfully":                          "Tâche supprimée",
+		"Todo is close to the tag limit":                     "La tâche approche de la limite d'étiquettes",
+		"Todo limit reached":                                 "Limite de tâches atteinte",
+		"Todo moved successfully":                            "Tâche déplacée",
+		"Todo not found":                                     "Tâche introuvable",
+		"Todo touched successfully":                          "Tâche rafraîchie",
+		"Todo updated successfully":                          "Tâche mise à jour",
+		"Todo was deleted":                                   "La tâche a été supprimée",
+		"Todos updated successfully":                         "Tâches mises à jour",
+		"Too many queries":                                   "Trop de requêtes",
+		"Too many reminders":                                 "Trop de rappels",
+		"Too many tags":                                      "Trop d'étiquettes",
+		"Too many todos":                                     "Trop de tâches",
+		"Too many todos match, narrow the filters":           "Trop de tâches correspondent, affinez les filtres",
+		"Unauthorized":                                       "Non autorisé",
+		"User-Agent header is required":                      "L'en-tête User-Agent est obligatoire",
+		"Validation failed":                                  "La validation a échoué",
+		"Write not durable":                                  "L'écriture n'est pas durable",
+		"ids are required":                                   "Les identifiants sont obligatoires",
+		"owner is required":                                  "Le propriétaire est obligatoire",
+	},
+}
+
+// msg translates an English message into the language the client prefers
+// according to its Accept-Language header.
+func msg(r *http.Request, text string) string {
+	for _, lang := range acceptedLanguages(r.Header.Get("Accept-Language")) {
+		if lang == "en" {
+			return text
+		}
+		if catalog, ok := messages[lang]; ok {
+			if translated, ok := catalog[text]; ok {
+				return translated
+			}
+			return text
+		}
+	}
+	return text
+}
+
+// acceptedLanguages returns the primary language subtags of an
+// Accept-Language header, most preferred first.
+func acceptedLanguages(header string) []string {
+	type weighted struct {
+		lang string
+		q    float64
+	}
+
+	langs := []weighted{}
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		lang := strings.ToLower(strings.TrimSpace(params[0]))
+		if lang == "" || lang == "*" {
+			continue
+		}
+		if i := strings.IndexByte(lang, '-'); i > 0 {
+			lang = lang[:i]
+		}
+
+		q := 1.0
+		for _, p := range params[1:] {
+			if k, v, ok := strings.Cut(strings.TrimSpace(p), "="); ok && k == "q" {
+				if f, err := strconv.ParseFloat(v, 64); err == nil {
+					q = f
+				}
+			}
+		}
+		if q > 0 {
+			langs = append(langs, weighted{lang, q})
+		}
+	}
+
+	sort.SliceStable(langs, func(i, j int) bool { return langs[i].q > langs[j].q })
+
+	out := make([]string, len(langs))
+	for i, l := range langs {
+		out[i] = l.lang
+	}
+	return out
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+const (
+	// importProgressEvery is how many records are processed between
+	// progress updates.
+	importProgressEvery = 100
+
+	// maxImportFailures bounds how many failed records are listed in the
+	// import summary; the errors count always covers all of them.
+	maxImportFailures = 100
+)
+
+// importSource returns the next record of an import and the 1-based line
+// it starts on, or io.EOF after the last one. Sources without meaningful
+// lines report 0.
+type importSource func() (todo, int, error)
+
+type importFailure struct {
+	Index int    `json:"index"`
+	Line  int    `json:"line,omitempty"`
+	Field string `json:"field,omitempty"`
+	Error string `json:"error"`
+}
+
+// importErrorFields names the field each record error is about.
+var importErrorFields = map[string]string{
+	"Title is required":                 "title",
+	"Title is too long":                 "title",
+	"Invalid status":                    "status",
+	"Invalid priority":                  "priority",
+	"Invalid startAt":                   "startAt",
+	"Invalid dueDate":                   "dueDate",
+	"Invalid tag":                       "tags",
+	"Too many tags":                     "tags",
+	"Subtask title is required":         "subtasks",
+	"Invalid reminders":                 "reminders",
+	"Too many reminders":                "reminders",
+	"Invalid parentId":                  "parentId",
+	"Parent todo not found":             "parentId",
+	"A todo cannot be its own parent":   "parentId",
+	"A todo cannot be its own ancestor": "parentId",
+	"Todo limit reached":                "owner",
+}
+
+type importProgress struct {
+	Processed int             `json:"processed"`
+	Imported  int             `json:"imported"`
+	Errors    int             `json:"errors"`
+	Done      bool            `json:"done,omitempty"`
+	Failures  []importFailure `json:"failures,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	Line      int             `json:"line,omitempty"`
+}
+
+// importTodos creates todos from a JSON array or, with Content-Type
+// text/csv, from CSV with a header row. Each record is validated and
+// created like POST /todo. Progress is streamed as newline delimited JSON
+// objects while the records are inserted, ending with a summary. Invalid
+// records are skipped and reported; a client disconnecting stops the
+// import after the current record, keeping the todos already created.
+func importTodos(w http.ResponseWriter, r *http.Request) {
+	var next importSource
+	var err error
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "text/csv" {
+		next, err = csvImport(r.Body)
+	} else {
+		next, err = jsonImport(r.Body)
+	}
+	if err != nil {
+		badRequest(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	report := func(p importProgress) {
+		if err := enc.Encode(p); err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	progress := importProgress{Failures: []importFailure{}}
+	fail := func(index, line int, err error) {
+		progress.Errors++
+		if len(progress.Failures) < maxImportFailures {
+			progress.Failures = append(progress.Failures, importFailure{
+				Index: index,
+				Line:  line,
+				Field: importErrorFields[err.Error()],
+				Error: msg(r, err.Error()),
+			})
+		}
+	}
+
+	for index := 0; ; index++ {
+		if err := r.Context().Err(); err != nil {
+			requestLog(r).Printf("Import aborted after %d records: %v", progress.Processed, err)
+			return
+		}
+
+		t, line, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			progress.Error = msg(r, "Invalid request body")
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				progress.Line = parseErr.StartLine
+			}
+			break
+		}
+
+		if err := importTodo(t, r); err != nil {
+			fail(index, line, err)
+		} else {
+			progress.Imported++
+		}
+
+		progress.Processed++
+		if progress.Processed%importProgressEvery == 0 {
+			report(importProgress{Processed: progress.Processed, Imported: progress.Imported, Errors: progress.Errors})
+		}
+	}
+
+	progress.Done = true
+	report(progress)
+}
+
+// importTodo validates and stores a single imported record.
+func importTodo(t todo, r *http.Request) error {
+	todo, err := newTodo(t, r)
+	if err != nil {
+		return err
+	}
+	if _, err := checkOwnerLimit(todo.Owner); err != nil {
+		if err == errOwnerLimit {
+			return err
+		}
+		return errors.New("Failed to create todo")
+	}
+	if _, err := storeTodo(todo); err != nil {
+		if isWriteConcernError(err) {
+			return errors.New("Write not durable")
+		}
+		return errors.New("Failed to create todo")
+	}
+	return nil
+}
+
+// jsonImport reads the records of a JSON array one at a time, so large
+// imports don't have to be held in memory.
+func jsonImport(body io.Reader) (importSource, error) {
+	dec := json.NewDecoder(body)
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		return nil, errors.New("Invalid request body")
+	}
+
+	return func() (todo, int, error) {
+		if !dec.More() {
+			if _, err := dec.Token(); err != nil {
+				return todo{}, 0, err
+			}
+			return todo{}, 0, io.EOF
+		}
+		var t todo
+		err := dec.Decode(&t)
+		return t, 0, err
+	}, nil
+}
+
+// csvImport reads CSV records with a header row naming their columns:
+// title, description, status, priority, tags (separated by spaces), owner,
+// startAt, dueDate and parentId. Only title is required; other columns are
+// ignored.
+func csvImport(body io.Reader) (importSource, error) {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, errors.New("Invalid request body")
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	if _, ok := columns["title"]; !ok {
+		return nil, errors.New("CSV needs a title column")
+	}
+
+	return func() (todo, int, error) {
+		record, err := reader.Read()
+		if err != nil {
+			return todo{}, 0, err
+		}
+		// FieldPos counts the lines of quoted fields spanning several
+		// lines, so this is where the record starts in the file.
+		line, _ := reader.FieldPos(0)
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return record[i]
+			}
+			return ""
+		}
+
+		t := todo{
+			Title:    field("title"),
+			Status:   field("status"),
+			Priority: field("priority"),
+			Owner:    field("owner"),
+			StartAt:  field("startAt"),
+			DueDate:  field("dueDate"),
+			ParentID: field("parentId"),
+		}
+		if description := field("description"); description != "" {
+			t.Description = &description
+		}
+		if _, ok := columns["tags"]; ok {
+			t.Tags = strings.Fields(field("tags"))
+		}
+		return t, line, nil
+	}, nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCSVImportLines(t *testing.T) {
+	tests := []struct {
+		name, body string
+		titles     []string
+		lines      []int
+	}{
+		{
+			name:   "single line records",
+			body:   "title\nA\nB\n",
+			titles: []string{"A", "B"},
+			lines:  []int{2, 3},
+		},
+		{
+			name:   "quoted fields spanning lines",
+			body:   "title,description\nA,one\n\"B\nmulti\",two\nC,\"x\ny\"\nD,z\n",
+			titles: []string{"A", "B\nmulti", "C", "D"},
+			lines:  []int{2, 3, 5, 7},
+		},
+	}
+	for _, tt := range tests {
+		next, err := csvImport(strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatalf("%s: csvImport error: %v", tt.name, err)
+		}
+
+		titles, lines := []string{}, []int{}
+		for {
+			todo, line, err := next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s: record %d error: %v", tt.name, len(lines), err)
+			}
+			titles = append(titles, todo.Title)
+			lines = append(lines, line)
+		}
+		if !reflect.DeepEqual(titles, tt.titles) {
+			t.Errorf("%s: titles = %q, want %q", tt.name, titles, tt.titles)
+		}
+		if !reflect.DeepEqual(lines, tt.lines) {
+			t.Errorf("%s: lines = %v, want %v", tt.name, lines, tt.lines)
+		}
+	}
+}
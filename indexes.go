@@ -0,0 +1,68 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// indexedFields are the fields the listing filters query on that can be
+// given an index at startup. tags is a multikey index.
+var indexedFields = []string{"tags", "owner", "priority", "dueDate"}
+
+// ensureIndexes creates the configured indexes that don't exist yet,
+// logging each one it creates.
+func ensureIndexes(fields []string) {
+	c := db.C(collectionName)
+	existing, err := c.Indexes()
+	checkErr(err)
+	have := map[string]bool{}
+	for _, index := range existing {
+		have[strings.Join(index.Key, ",")] = true
+	}
+
+	for _, field := range fields {
+		if !validIndexField(field) {
+			log.Printf("Ignoring unknown index field %q", field)
+			continue
+		}
+		if have[field] {
+			continue
+		}
+		checkErr(c.EnsureIndex(mgo.Index{Key: []string{field}, Background: true}))
+		log.Printf("Created index on %s", field)
+	}
+}
+
+func validIndexField(field string) bool {
+	for _, f := range indexedFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// warmUp runs the default listing query and one query per indexed field
+// so the connection pool and the indexes are in use before the first
+// request arrives. Failures are logged; the server starts regardless.
+func warmUp() {
+	start := time.Now()
+	c := db.C(collectionName)
+	var t todoModel
+
+	queries := []*mgo.Query{c.Find(nil).Sort("createdAt", "_id")}
+	for _, field := range cfg.indexes {
+		queries = append(queries, c.Find(bson.M{field: bson.M{"$exists": true}}).Sort(field))
+	}
+	for _, query := range queries {
+		if err := query.One(&t); err != nil && err != mgo.ErrNotFound {
+			log.Println("Warm-up query failed", err)
+			return
+		}
+	}
+	log.Printf("Warm-up finished in %v", time.Since(start))
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// startJob runs fn every interval in the background until ctx is done.
+func startJob(ctx context.Context, name string, interval time.Duration, fn func()) {
+	if interval <= 0 {
+		log.Printf("Not starting background job %s, interval %v is not positive", name, interval)
+		return
+	}
+	log.Printf("Starting background job %s every %v", name, interval)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				log.Printf("Stopped background job %s", name)
+				return
+			case <-ticker.C:
+				fn()
+			}
+		}
+	}()
+}
+
+// startJobs starts the background jobs enabled in the configuration.
+func startJobs(ctx context.Context) {
+	if cfg.autoCompleteOverdueAfter > 0 {
+		startJob(ctx, "auto-complete-overdue", cfg.jobInterval, autoCompleteOverdue)
+	}
+	if cfg.archiveCompletedAfter > 0 {
+		startJob(ctx, "archive-completed", cfg.jobInterval, archiveCompleted)
+	}
+}
+
+// autoCompleteOverdue completes the incomplete, unarchived todos that have
+// been overdue for longer than the configured grace period, recording why
+// on each todo.
+func autoCompleteOverdue() {
+	now := time.Now()
+
+	todos := []todoModel{}
+	if err := db.C(collectionName).Find(bson.M{
+		"completed": false,
+		"archived":  bson.M{"$ne": true},
+		"dueDate":   bson.M{"$lt": now.Add(-cfg.autoCompleteOverdueAfter)},
+	}).Select(bson.M{"_id": 1}).All(&todos); err != nil {
+		log.Println("Failed to find overdue todos", err)
+		return
+	}
+	if len(todos) == 0 {
+		return
+	}
+
+	ids := []bson.ObjectId{}
+	for _, t := range todos {
+		ids = append(ids, t.ID)
+	}
+
+	info, err := db.C(collectionName).UpdateAll(
+		bson.M{"_id": bson.M{"$in": ids}, "completed": false, "archived": bson.M{"$ne": true}},
+		bson.M{"$set": bson.M{
+			"completed":       true,
+			"status":          statusDone,
+			"completedAt":     now,
+			"completedReason": completedReasonOverdue,
+			"updatedAt":       now,
+		}},
+	)
+	if err != nil {
+		log.Println("Failed to auto-complete overdue todos", err)
+		return
+	}
+
+	updated := len(ids)
+	if info != nil {
+		updated = info.Updated
+	}
+	log.Printf("WARN auto-completed %d todos overdue by more than %v: %v", updated, cfg.autoCompleteOverdueAfter, ids)
+}
+
+// archiveCompleted archives the todos completed longer ago than the
+// configured delay.
+func archiveCompleted() {
+	now := time.Now()
+
+	todos := []todoModel{}
+	if err := db.C(collectionName).Find(bson.M{
+		"completed":   true,
+		"archived":    bson.M{"$ne": true},
+		"completedAt": bson.M{"$lt": now.Add(-cfg.archiveCompletedAfter)},
+	}).Select(bson.M{"_id": 1}).All(&todos); err != nil {
+		log.Println("Failed to find completed todos to archive", err)
+		return
+	}
+	if len(todos) == 0 {
+		return
+	}
+
+	ids := []bson.ObjectId{}
+	for _, t := range todos {
+		ids = append(ids, t.ID)
+	}
+
+	info, err := db.C(collectionName).UpdateAll(
+		bson.M{"_id": bson.M{"$in": ids}, "completed": true},
+		bson.M{"$set": bson.M{
+			"archived":   true,
+			"archivedAt": now,
+			"updatedAt":  now,
+		}},
+	)
+	if err != nil {
+		log.Println("Failed to archive completed todos", err)
+		return
+	}
+
+	archived := len(ids)
+	if info != nil {
+		archived = info.Updated
+	}
+	log.Printf("Archived %d todos completed more than %v ago: %v", archived, cfg.archiveCompletedAfter, ids)
+}
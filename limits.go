@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/thedevsaddam/renderer"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var errOwnerLimit = errors.New("Todo limit reached")
+
+// capItems limits a query feeding a whole-listing response to one more
+// todo than the response item cap, so exceeding the cap can be detected
+// without loading every match.
+func capItems(query *mgo.Query) *mgo.Query {
+	if cfg.maxResponseItems <= 0 {
+		return query
+	}
+	return query.Limit(cfg.maxResponseItems + 1)
+}
+
+// tooManyItems responds with 413 and reports true when n todos exceed the
+// response item cap.
+func tooManyItems(w http.ResponseWriter, r *http.Request, n int) bool {
+	if cfg.maxResponseItems <= 0 || n <= cfg.maxResponseItems {
+		return false
+	}
+	rnd.JSON(w, http.StatusRequestEntityTooLarge, renderer.M{
+		"message":  msg(r, "Too many todos match, narrow the filters"),
+		"maxItems": cfg.maxResponseItems,
+	})
+	return true
+}
+
+// checkOwnerLimit returns how many unarchived todos owner has, or
+// errOwnerLimit when they can't create another one. Todos without an owner
+// are not limited. The count is not atomic with the insert that follows,
+// so concurrent creates can take an owner past the limit.
+func checkOwnerLimit(owner string) (int, error) {
+	if cfg.maxTodosPerOwner <= 0 || owner == "" {
+		return 0, nil
+	}
+	n, err := db.C(collectionName).Find(bson.M{"owner": owner, "archived": bson.M{"$ne": true}}).Count()
+	if err != nil {
+		return 0, err
+	}
+	if n >= cfg.maxTodosPerOwner {
+		return n, errOwnerLimit
+	}
+	return n, nil
+}
+
+// nearLimit reports whether n has reached the warning share of max.
+func nearLimit(n, max int) bool {
+	return max > 0 && n*100 >= max*cfg.limitWarningPercent
+}
+
+// limitWarnings are the warnings for a created todo whose owner now has
+// owned todos, in English, for clients to show before a limit is hit.
+func limitWarnings(t todoModel, owned int) []string {
+	warnings := []string{}
+	if t.Owner != "" && nearLimit(owned, cfg.maxTodosPerOwner) {
+		warnings = append(warnings, "Owner is close to the todo limit")
+	}
+	if nearLimit(len(t.Tags), maxTagsPerTodo) {
+		warnings = append(warnings, "Todo is close to the tag limit")
+	}
+	return warnings
+}
+
+// warn adds the warnings to the response as Warning headers and returns
+// them translated for the response body.
+func warn(w http.ResponseWriter, r *http.Request, warnings []string) []string {
+	translated := []string{}
+	for _, warning := range warnings {
+		w.Header().Add("Warning", `299 - "`+warning+`"`)
+		translated = append(translated, msg(r, warning))
+	}
+	return translated
+}
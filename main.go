@@ -3,15 +3,21 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"os"
+	"net/url"
 	"os/signal"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
+	"unicode/utf8"
 
 	"github.com/go-chi/chi"
-	"github.com/go-chi/chi/middleware"
 	"github.com/thedevsaddam/renderer"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
@@ -20,35 +26,177 @@ import (
 var rnd *renderer.Render
 var db*mgo.Database
 
+// ready reports whether the server accepts new traffic. It is cleared when
+// shutdown begins so /healthz fails before connections are closed.
+var ready atomic.Bool
+
+// apiRoutes lists the routes served by the API, for the JSON index on /.
+var apiRoutes []apiRoute
+
 const (
 	hostName  	string = "localhost:27017"
 	dbName			string = "todo-app"
 	collectionName  string = "todos"
+	tombstoneCollectionName string = "tombstones"
 	port 				string = ":9000"
 )
 
+const (
+	statusTodo  string = "todo"
+	statusDoing string = "doing"
+	statusDone  string = "done"
+)
+
+// completedReasonOverdue marks todos completed by the background job
+// because they were overdue for too long.
+const completedReasonOverdue = "overdue"
+
+// maxTitleLength is the longest title allowed, in characters.
+const maxTitleLength = 500
+
+const (
+	priorityLow    string = "low"
+	priorityMedium string = "medium"
+	priorityHigh   string = "high"
+)
+
 type (
 	todoModel struct {
 		ID 			bson.ObjectId `bson:"_id,omitempty"`
 		Title 	string				`bson:"title"`
+		TitleEncrypted bool		`bson:"titleEncrypted,omitempty" json:"-"`
+		Description string		`bson:"description,omitempty"`
 		Completed bool				`bson:"completed"`
+		Status    string			`bson:"status"`
+		Position  float64			`bson:"position"`
+		Seq       int64				`bson:"seq,omitempty"`
+		StartAt   *time.Time		`bson:"startAt,omitempty"`
+		DueDate   *time.Time		`bson:"dueDate,omitempty"`
+		Reminders []time.Time		`bson:"reminders,omitempty"`
+		RemindersFired []time.Time	`bson:"remindersFired,omitempty"`
+		NextReminderAt *time.Time	`bson:"nextReminderAt,omitempty"`
+		Tags      []string			`bson:"tags,omitempty"`
+		Priority  string			`bson:"priority,omitempty"`
+		Subtasks  []subtask			`bson:"subtasks,omitempty"`
+		ParentID  bson.ObjectId	`bson:"parentId,omitempty"`
+		CompletedAt *time.Time	`bson:"completedAt,omitempty"`
+		CompletedReason string	`bson:"completedReason,omitempty"`
+		Archived  bool				`bson:"archived,omitempty"`
+		ArchivedAt *time.Time		`bson:"archivedAt,omitempty"`
+		Owner     string			`bson:"owner,omitempty"`
+		LastUpdatedBy string	`bson:"lastUpdatedBy,omitempty"`
+		ClaimedBy string			`bson:"claimedBy,omitempty"`
+		ClaimedAt *time.Time		`bson:"claimedAt,omitempty"`
 		CreatedAt time.Time		`bson:"createdAt"`
+		UpdatedAt time.Time		`bson:"updatedAt"`
+	}
+
+	subtask struct {
+		Title     string `bson:"title" json:"title"`
+		Completed bool   `bson:"completed" json:"completed"`
+	}
+
+	apiRoute struct {
+		Method string `json:"method"`
+		Path   string `json:"path"`
 	}
 
 	todo struct {
 		ID 			string `json:"id"`
 		Title 	string `json:"title"`
+		Description *string `json:"description,omitempty"`
 		Completed bool `json:"completed"`
+		Status    string `json:"status"`
+		Position  float64 `json:"position"`
+		Seq       int64 `json:"seq"`
+		StartAt   string `json:"startAt,omitempty"`
+		DueDate   string `json:"dueDate,omitempty"`
+		Reminders []string `json:"reminders"`
+		Tags      []string `json:"tags"`
+		Priority  string `json:"priority,omitempty"`
+		Subtasks  []subtask `json:"subtasks"`
+		ParentID  string `json:"parentId,omitempty"`
+		Progress  int `json:"progress"`
+		NextAction string `json:"nextAction,omitempty"`
+		CompletedAt string `json:"completedAt,omitempty"`
+		CompletedReason string `json:"completedReason,omitempty"`
+		Archived  bool `json:"archived"`
+		ArchivedAt string `json:"archivedAt,omitempty"`
+		Owner     string `json:"owner,omitempty"`
+		LastUpdatedBy string `json:"lastUpdatedBy,omitempty"`
+		ClaimedBy string `json:"claimedBy,omitempty"`
+		ClaimedAt string `json:"claimedAt,omitempty"`
 		CreatedAt string `json:"createdAt"`
+		UpdatedAt string `json:"updatedAt"`
+		Hash      string `json:"hash"`
+	}
+
+	// todoSummary is the trimmed shape returned by the summary view.
+	todoSummary struct {
+		ID        string `json:"id"`
+		Title     string `json:"title"`
+		Completed bool   `json:"completed"`
 	}
 )
 
+// todoViews are the predefined shapes a todo listing can be returned in,
+// selected with the view query parameter.
+var todoViews = map[string]func(todoModel) interface{}{
+	"full": func(t todoModel) interface{} {
+		return toTodo(t)
+	},
+	"summary": func(t todoModel) interface{} {
+		return todoSummary{ID: t.ID.Hex(), Title: plainTitle(t), Completed: t.Completed}
+	},
+}
+
 func init () {
+	cfg = loadConfig()
 	rnd = renderer.New()
+	var err error
+	titleCipher, err = newTitleCipher(cfg.titleKey)
+	checkErr(err)
+	contentKey, err = newContentKey(cfg.titleKey)
+	checkErr(err)
+	cfg.defaultTags, err = normalizeTags(cfg.defaultTags)
+	checkErr(err)
+}
+
+// connect opens the database session and brings the stored todos up to
+// date before the server starts.
+func connect() {
+	mgo.SetStats(true)
 	session, err := mgo.Dial(hostName)
 	checkErr(err)
 	session.SetMode(mgo.Monotonic, true)
+	safe, err := writeConcernSafe(cfg.writeConcern, cfg.writeTimeoutMs)
+	checkErr(err)
+	session.SetSafe(safe)
 	db = session.DB(dbName)
+	migrateStatus()
+	migratePositions()
+	migrateSeq()
+	migrateNextReminder()
+	migrateUpdatedAt()
+	ensureIndexes(cfg.indexes)
+	if cfg.dedupeWindow > 0 {
+		ensureDedupeIndex()
+	}
+}
+
+// migrateStatus backfills the status of todos stored before the field
+// existed, deriving it from their completed flag.
+func migrateStatus() {
+	for status, completed := range map[string]bool{statusDone: true, statusTodo: false} {
+		info, err := db.C(collectionName).UpdateAll(
+			bson.M{"status": bson.M{"$exists": false}, "completed": completed},
+			bson.M{"$set": bson.M{"status": status}},
+		)
+		checkErr(err)
+		if info != nil && info.Updated > 0 {
+			log.Printf("Migrated %d todos to status %q", info.Updated, status)
+		}
+	}
 }
 
 func checkErr(err error) {
@@ -57,36 +205,579 @@ func checkErr(err error) {
 	}
 }
 
+func validStatus(status string) bool {
+	switch status {
+	case statusTodo, statusDoing, statusDone:
+		return true
+	}
+	return false
+}
+
+func validPriority(priority string) bool {
+	switch priority {
+	case priorityLow, priorityMedium, priorityHigh:
+		return true
+	}
+	return false
+}
+
+// statusFromCompleted derives the status for clients that only know about
+// the completed flag. They keep a todo's in-progress status unless they are
+// completing or reopening it.
+func statusFromCompleted(completed bool, current todoModel) string {
+	switch {
+	case completed:
+		return statusDone
+	case current.Status == statusDone || current.Status == "":
+		return statusTodo
+	default:
+		return current.Status
+	}
+}
+
+// validTitle checks a normalized title.
+func validTitle(title string) error {
+	if title == "" {
+		return errors.New("Title is required")
+	}
+	if utf8.RuneCountInString(title) > maxTitleLength {
+		return errors.New("Title is too long")
+	}
+	return nil
+}
+
+// todoFilter builds the Mongo query for a todo listing from its query
+// parameters.
+func todoFilter(q url.Values) (bson.M, error) {
+	filter := bson.M{}
+
+	if status := strings.TrimSpace(q.Get("status")); status != "" {
+		if !validStatus(status) {
+			return nil, errors.New("Invalid status")
+		}
+		filter["status"] = status
+	}
+
+	if completed := strings.TrimSpace(q.Get("completed")); completed != "" {
+		b, err := strconv.ParseBool(completed)
+		if err != nil {
+			return nil, errors.New("Invalid completed")
+		}
+		filter["completed"] = b
+	}
+
+	if priority := strings.TrimSpace(q.Get("priority")); priority != "" {
+		if !validPriority(priority) {
+			return nil, errors.New("Invalid priority")
+		}
+		filter["priority"] = priority
+	}
+
+	if v := strings.TrimSpace(q.Get("sinceSeq")); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			return nil, errors.New("Invalid sinceSeq")
+		}
+		addCondition(filter, bson.M{"seq": bson.M{"$gt": n}})
+	}
+
+	if v := strings.TrimSpace(q.Get("titleLongerThan")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, errors.New("Invalid titleLongerThan")
+		}
+		addCondition(filter, bson.M{"$expr": bson.M{"$gt": []interface{}{bson.M{"$strLenCP": "$title"}, n}}})
+	}
+
+	if v := strings.TrimSpace(q.Get("hasDescription")); v != "" {
+		has, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, errors.New("Invalid hasDescription")
+		}
+		if has {
+			addCondition(filter, bson.M{"description": bson.M{"$exists": true, "$ne": ""}})
+		} else {
+			addCondition(filter, bson.M{"$or": []bson.M{
+				{"description": bson.M{"$exists": false}},
+				{"description": ""},
+			}})
+		}
+	}
+
+	// A missing q never filters. An empty one filters nothing or
+	// everything depending on configuration.
+	if q.Has("q") {
+		term := strings.TrimSpace(q.Get("q"))
+		switch {
+		case term != "":
+			pattern := bson.RegEx{Pattern: regexp.QuoteMeta(term), Options: "i"}
+			// Encrypted titles are ciphertext, which the pattern could
+			// match by accident.
+			addCondition(filter, bson.M{"$or": []bson.M{
+				{"title": pattern, "titleEncrypted": bson.M{"$ne": true}},
+				{"description": pattern},
+			}})
+		case cfg.emptySearchMatchesNothing:
+			addCondition(filter, bson.M{"_id": bson.M{"$in": []bson.ObjectId{}}})
+		}
+	}
+
+	if tag := strings.TrimSpace(q.Get("tag")); tag != "" {
+		filter["tags"] = strings.ToLower(tag)
+	}
+
+	completedAt := bson.M{}
+	// Bounds are checked in a fixed order so the same invalid request
+	// always reports the same error.
+	for _, bound := range []struct{ param, op string }{{"completedFrom", "$gte"}, {"completedTo", "$lte"}} {
+		param, op := bound.param, bound.op
+		at, err := parseOptionalTime(strings.TrimSpace(q.Get(param)), param)
+		if err != nil {
+			return nil, err
+		}
+		if at != nil {
+			completedAt[op] = *at
+		}
+	}
+	if len(completedAt) > 0 {
+		addCondition(filter, bson.M{"completed": true, "completedAt": completedAt})
+	}
+
+	// Archived todos are only listed when asked for.
+	archived := false
+	if v := strings.TrimSpace(q.Get("archived")); v != "" {
+		var err error
+		if archived, err = strconv.ParseBool(v); err != nil {
+			return nil, errors.New("Invalid archived")
+		}
+	}
+	if archived {
+		filter["archived"] = true
+	} else {
+		filter["archived"] = bson.M{"$ne": true}
+	}
+
+	// Todos scheduled to start in the future stay hidden until then.
+	include := false
+	if v := strings.TrimSpace(q.Get("includeScheduled")); v != "" {
+		var err error
+		if include, err = strconv.ParseBool(v); err != nil {
+			return nil, errors.New("Invalid includeScheduled")
+		}
+	}
+	if !include {
+		addCondition(filter, bson.M{"$or": []bson.M{
+			{"startAt": bson.M{"$exists": false}},
+			{"startAt": bson.M{"$lte": time.Now()}},
+		}})
+	}
+
+	return filter, nil
+}
+
+// addCondition adds cond to filter, combining it with any conditions
+// already using the same operators.
+func addCondition(filter bson.M, cond bson.M) {
+	and, _ := filter["$and"].([]bson.M)
+	filter["$and"] = append(and, cond)
+}
+
+// parseOptionalTime parses the optional timestamp field named field,
+// returning nil when it is empty.
+func parseOptionalTime(value, field string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := parseTime(value)
+	if err != nil {
+		return nil, &dateError{field: field}
+	}
+	return &t, nil
+}
+
+func hexOrEmpty(id bson.ObjectId) string {
+	if id == "" {
+		return ""
+	}
+	return id.Hex()
+}
+
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func tagsOrEmpty(tags []string) []string {
+	if tags == nil {
+		return []string{}
+	}
+	return tags
+}
+
+func subtasksOrEmpty(subtasks []subtask) []subtask {
+	if subtasks == nil {
+		return []subtask{}
+	}
+	return subtasks
+}
+
+// normalizeSubtasks tidies subtask titles and checks none are empty.
+func normalizeSubtasks(subtasks []subtask) ([]subtask, error) {
+	out := []subtask{}
+	for _, st := range subtasks {
+		st.Title = normalizeTitle(st.Title)
+		if strings.TrimSpace(st.Title) == "" {
+			return nil, errors.New("Subtask title is required")
+		}
+		out = append(out, st)
+	}
+	return out, nil
+}
+
+// progress is the percentage of a todo's subtasks that are completed. A
+// todo without subtasks is either 0 or 100 percent done.
+func progress(t todoModel) int {
+	if len(t.Subtasks) == 0 {
+		if t.Completed {
+			return 100
+		}
+		return 0
+	}
+	done := 0
+	for _, st := range t.Subtasks {
+		if st.Completed {
+			done++
+		}
+	}
+	return done * 100 / len(t.Subtasks)
+}
+
+// nextAction hints at what a todo needs at now, for clients to show as a
+// badge. Completed todos need nothing and get no hint.
+func nextAction(t todoModel, now time.Time) string {
+	if t.Completed {
+		return ""
+	}
+	switch {
+	case t.DueDate != nil && t.DueDate.Before(now):
+		return "overdue"
+	case t.DueDate != nil && t.DueDate.Sub(now) <= dueSoonWindow:
+		return "dueSoon"
+	}
+	for _, st := range t.Subtasks {
+		if !st.Completed {
+			return "blocked"
+		}
+	}
+	if t.DueDate == nil {
+		return "noDueDate"
+	}
+	return ""
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// pagination reads the offset and limit query parameters.
+func pagination(q url.Values) (int, int, error) {
+	skip, limit := 0, defaultPageSize
+	if v := q.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return 0, 0, errors.New("Invalid offset")
+		}
+		skip = n
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPageSize {
+			return 0, 0, errors.New("Invalid limit")
+		}
+		limit = n
+	}
+	return skip, limit, nil
+}
+
+// todoSort returns the sort fields for a todo listing, oldest first by
+// default. Fields may be prefixed with "-" for descending order.
+func todoSort(q url.Values) ([]string, error) {
+	sort := strings.TrimSpace(q.Get("sort"))
+	if sort == "" {
+		sort = "createdAt"
+	}
+
+	switch field := strings.TrimPrefix(sort, "-"); field {
+	case "createdAt":
+		// Todos created together can share a timestamp, so break ties
+		// on _id to keep the order stable between requests.
+		return []string{sort, strings.TrimSuffix(sort, field) + "_id"}, nil
+	case "position", "title", "seq":
+		return []string{sort}, nil
+	}
+	return nil, errors.New("Invalid sort")
+}
+
+// normalizeTitle tidies a user supplied title when title normalization is
+// enabled.
+func normalizeTitle(title string) string {
+	if !cfg.normalizeTitles {
+		return title
+	}
+	return strings.Join(strings.Fields(title), " ")
+}
+
+func toTodo(t todoModel) todo {
+	return todo{
+		ID: t.ID.Hex(),
+		Title: plainTitle(t),
+		Description: optionalString(t.Description),
+		Completed: t.Completed,
+		Status: t.Status,
+		Position: t.Position,
+		Seq: t.Seq,
+		StartAt: formatTime(t.StartAt),
+		DueDate: formatTime(t.DueDate),
+		Reminders: formatReminders(t.Reminders),
+		Tags: tagsOrEmpty(t.Tags),
+		Priority: t.Priority,
+		Subtasks: subtasksOrEmpty(t.Subtasks),
+		ParentID: hexOrEmpty(t.ParentID),
+		Progress: progress(t),
+		NextAction: nextAction(t, time.Now()),
+		CompletedAt: formatTime(t.CompletedAt),
+		CompletedReason: t.CompletedReason,
+		Archived: t.Archived,
+		ArchivedAt: formatTime(t.ArchivedAt),
+		Owner: t.Owner,
+		LastUpdatedBy: t.LastUpdatedBy,
+		ClaimedBy: t.ClaimedBy,
+		ClaimedAt: formatTime(t.ClaimedAt),
+		CreatedAt: t.CreatedAt.Format("2006-01-02 15:04:05"),
+		UpdatedAt: formatTime(&t.UpdatedAt),
+		Hash: todoHash(t),
+	}
+}
+
+func apiIndex(w http.ResponseWriter, r *http.Request) {
+	rnd.JSON(w, http.StatusOK, renderer.M{
+		"name": "goTodo",
+		"routes": apiRoutes,
+	})
+}
+
 func homeHandler(w http.ResponseWriter, r *http.Request) {
-	err := rnd.Template(w, http.StatusOK, []string{"static/home.tpl"}, nil)
-	checkErr(err)
+	if negotiate(r, "text/html", "application/json") == "application/json" {
+		apiIndex(w, r)
+		return
+	}
+
+	if err := renderTemplate(w, http.StatusOK, "home.tpl", nil); err != nil {
+		requestLog(r).Println("Failed to render home page", err)
+		errorPage(w, r, http.StatusInternalServerError, "Something went wrong")
+	}
+}
+
+func healthz(w http.ResponseWriter, r *http.Request) {
+	if !ready.Load() {
+		rnd.JSON(w, http.StatusServiceUnavailable, renderer.M{
+			"status": "shutting down",
+		})
+		return
+	}
+
+	if err := db.Session.Ping(); err != nil {
+		rnd.JSON(w, http.StatusServiceUnavailable, renderer.M{
+			"status": "unavailable",
+		})
+		return
+	}
+
+	rnd.JSON(w, http.StatusOK, renderer.M{
+		"status": "ok",
+	})
 }
 
 func getAllTodo (w http.ResponseWriter, r *http.Request) {
 	todos := []todoModel{}
 
-	if err := db.C(collectionName).Find(bson.M{}).All(&todos); err != nil {
+	filter, err := todoFilter(r.URL.Query())
+	if err != nil {
+		badRequest(w, r, err)
+		return
+	}
+
+	sort, err := todoSort(r.URL.Query())
+	if err != nil {
+		badRequest(w, r, err)
+		return
+	}
+
+	view := r.URL.Query().Get("view")
+	if view == "" {
+		view = "full"
+	}
+	render, ok := todoViews[view]
+	if !ok {
 		rnd.JSON(w, http.StatusBadRequest, renderer.M{
-			"message": "Failed to get todos",
+			"message": msg(r, "Invalid view"),
+		})
+		return
+	}
+
+	if err := capItems(db.C(collectionName).Find(filter).Sort(sort...)).All(&todos); err != nil {
+		rnd.JSON(w, http.StatusBadRequest, renderer.M{
+			"message": msg(r, "Failed to get todos"),
 			"error": err,
 		})
 		return
 	}
-	todoList := []todo{}
+	if tooManyItems(w, r, len(todos)) {
+		return
+	}
+	todoList := []interface{}{}
 
 		for _, t := range todos {
-			todoList = append(todoList, todo{
-				ID: t.ID.Hex(),
-				Title: t.Title,
-				Completed: t.Completed,
-				CreatedAt: t.CreatedAt.Format("2006-01-02 15:04:05"),
-			})
+			todoList = append(todoList, render(t))
 		}
 		rnd.JSON(w, http.StatusOK, renderer.M{
 			"data": todoList,
 		})
 }
 
+func getTodo (w http.ResponseWriter, r *http.Request) {
+	t, err := findTodo(chi.URLParam(r, "id"))
+	if err != nil {
+		storeFailed(w, r, err)
+		return
+	}
+
+	data := toTodo(t)
+	if notModified(w, r, data.Hash) {
+		return
+	}
+
+	rnd.JSON(w, http.StatusOK, renderer.M{
+		"data": data,
+	})
+}
+
+// newTodo applies the rules for creating a todo to the client's input and
+// returns the todo to store, without its id and position. It only reads
+// the database to check the parent exists, and writes nothing, so the same
+// rules can pre-validate todos before an import.
+func newTodo(t todo, r *http.Request) (todoModel, error) {
+	t.Title = normalizeTitle(t.Title)
+
+	if err := validTitle(t.Title); err != nil {
+		return todoModel{}, err
+	}
+
+	if t.Status == "" {
+		t.Status = statusTodo
+	}
+
+	if !validStatus(t.Status) {
+		return todoModel{}, errors.New("Invalid status")
+	}
+
+	startAt, err := parseOptionalTime(t.StartAt, "startAt")
+	if err != nil {
+		return todoModel{}, err
+	}
+
+	dueDate, err := parseOptionalTime(t.DueDate, "dueDate")
+	if err != nil {
+		return todoModel{}, err
+	}
+
+	// Default tags only apply when the client leaves tags out; any tags it
+	// sends, including an empty list, replace them.
+	if t.Tags == nil {
+		t.Tags = cfg.defaultTags
+	}
+
+	tags, err := normalizeTags(t.Tags)
+	if err != nil {
+		return todoModel{}, err
+	}
+
+	subtasks, err := normalizeSubtasks(t.Subtasks)
+	if err != nil {
+		return todoModel{}, err
+	}
+
+	if t.Priority == "" {
+		t.Priority = priorityMedium
+	}
+
+	if !validPriority(t.Priority) {
+		return todoModel{}, errors.New("Invalid priority")
+	}
+
+	parentID, err := parseParentID(strings.TrimSpace(t.ParentID))
+	if err != nil {
+		return todoModel{}, err
+	}
+
+	if parentID != "" {
+		if err := checkParent("", parentID); err != nil {
+			return todoModel{}, err
+		}
+	}
+
+	reminders, err := parseReminders(t.Reminders)
+	if err != nil {
+		return todoModel{}, err
+	}
+
+	owner := strings.TrimSpace(t.Owner)
+	if owner == "" {
+		owner = requestUser(r)
+	}
+
+	now := time.Now()
+	var completedAt *time.Time
+	if t.Status == statusDone {
+		completedAt = &now
+	}
+
+	description := ""
+	if t.Description != nil {
+		description = strings.TrimSpace(*t.Description)
+	}
+
+	return todoModel{
+		Title: t.Title,
+		Description: description,
+		Completed: t.Status == statusDone,
+		Status: t.Status,
+		StartAt: startAt,
+		DueDate: dueDate,
+		Reminders: reminders,
+		NextReminderAt: nextReminder(reminders, nil),
+		Tags: tags,
+		Priority: t.Priority,
+		Subtasks: subtasks,
+		ParentID: parentID,
+		CompletedAt: completedAt,
+		Owner: owner,
+		LastUpdatedBy: requestUser(r),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}, nil
+}
+
 func createTodo (w http.ResponseWriter, r *http.Request) {
 	var t todo
 
@@ -95,54 +786,77 @@ func createTodo (w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if t .Title == "" {
-		rnd.JSON(w, http.StatusBadRequest, renderer.M{
-			"message": "Title is required",
-		})
+	todo, owned, err := addTodo(t, r)
+	if err != nil {
+		storeFailed(w, r, err)
 		return
 	}
 
-	todo := todoModel{
-		ID: bson.NewObjectId(),
-		Title: t.Title,
-		Completed: false,
-		CreatedAt: time.Now(),
+	response := renderer.M{
+		"message": msg(r, "Todo created successfully"),
+		"data": toTodo(todo),
+	}
+	if warnings := limitWarnings(todo, owned+1); len(warnings) > 0 {
+		response["warnings"] = warn(w, r, warnings)
 	}
+	rnd.JSON(w, http.StatusCreated, response)
+}
 
-	if err := db.C(collectionName).Insert(todo); err != nil {
-		rnd.JSON(w, http.StatusBadRequest, renderer.M{
-			"message": "Failed to create todo",
-			"error": err,
-		})
-		return
+// storeTodo inserts a validated todo at the end of the list, assigning its
+// id unless it already has one, its position and its sequence number. The
+// returned todo has them set.
+func storeTodo(todo todoModel) (todoModel, error) {
+	var err error
+	if todo.ID == "" {
+		todo.ID = bson.NewObjectId()
+	}
+	todo.Position, err = nextPosition()
+	if err != nil {
+		return todoModel{}, err
 	}
 
-	rnd.JSON(w, http.StatusCreated, renderer.M{
-		"message": "Todo created successfully",
-		"data": todo,
-	})
+	stored := todo
+	stored.Title, stored.TitleEncrypted, err = sealTitle(todo.Title)
+	if err != nil {
+		return todoModel{}, err
+	}
+
+	// Numbering and inserting happen as one step, so todos become
+	// visible in seq order and a failed insert gives its number back.
+	seqMu.Lock()
+	defer seqMu.Unlock()
+
+	todo.Seq, err = nextSeq()
+	if err != nil {
+		return todoModel{}, err
+	}
+	stored.Seq = todo.Seq
+
+	if err := db.C(collectionName).Insert(stored); err != nil {
+		releaseSeq(todo.Seq)
+		return todoModel{}, err
+	}
+	return todo, nil
 }
 
 func deleteTodo (w http.ResponseWriter, r *http.Request) {
-	id := strings.TrimSpace(chi.URLParam(r, "id"))
-
-	if !bson.IsObjectIdHex(id) {
-		rnd.JSON(w, http.StatusBadRequest, renderer.M{
-			"message": "Invalid id",
-		})
+	// Children of the deleted todo are moved up to its parent unless
+	// the client asks for them to be deleted too.
+	cascade, err := childrenMode(r.URL.Query().Get("children"))
+	if err != nil {
+		badRequest(w, r, err)
 		return
 	}
 
-	if err := db.C(collectionName).RemoveId(bson.ObjectIdHex(id)); err != nil {
-		rnd.JSON(w, http.StatusBadRequest, renderer.M{
-			"message": "Failed to delete todo",
-			"error": err,
-		})
+	deleted, err := removeTodo(chi.URLParam(r, "id"), cascade)
+	if err != nil {
+		storeFailed(w, r, err)
 		return
 	}
 
 	rnd.JSON(w, http.StatusOK, renderer.M{
-		"message": "Todo deleted successfully",
+		"message": msg(r, "Todo deleted successfully"),
+		"data": toTodo(deleted),
 	})
 }
 
@@ -151,7 +865,7 @@ func updateTodo (w http.ResponseWriter, r *http.Request) {
 
 	if !bson.IsObjectIdHex(id) {
 		rnd.JSON(w, http.StatusBadRequest, renderer.M{
-			"message": "Invalid id",
+			"message": msg(r, "Invalid id"),
 		})
 		return
 	}
@@ -163,36 +877,200 @@ func updateTodo (w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if t .Title == "" {
+	t.Title = normalizeTitle(t.Title)
+
+	if err := validTitle(t.Title); err != nil {
+		badRequest(w, r, err)
+		return
+	}
+
+	var current todoModel
+	if err := db.C(collectionName).FindId(bson.ObjectIdHex(id)).One(&current); err != nil {
+		if err == mgo.ErrNotFound {
+			rnd.JSON(w, http.StatusNotFound, renderer.M{
+				"message": msg(r, "Todo not found"),
+			})
+			return
+		}
 		rnd.JSON(w, http.StatusBadRequest, renderer.M{
-			"message": "Title is required",
+			"message": msg(r, "Failed to update todo"),
+			"error": err,
 		})
 		return
 	}
 
-	if err := db.C(collectionName).Update(
-		bson.M{"_id": bson.ObjectIdHex(id)},
-		bson.M{"$set": bson.M{
-			"title": t.Title,
-			"completed": t.Completed,
-		}},
-	); err != nil {
+	if t.Status == "" {
+		t.Status = statusFromCompleted(t.Completed, current)
+	}
+
+	if !validStatus(t.Status) {
 		rnd.JSON(w, http.StatusBadRequest, renderer.M{
-			"message": "Failed to update todo",
-			"error": err,
+			"message": msg(r, "Invalid status"),
 		})
 		return
 	}
+
+	set := bson.M{
+		"completed": t.Status == statusDone,
+		"status": t.Status,
+	}
+
+	// Sealing a title always yields new ciphertext, so only store it
+	// when it actually changed.
+	if t.Title != plainTitle(current) {
+		title, encrypted, err := sealTitle(t.Title)
+		if err != nil {
+			rnd.JSON(w, http.StatusBadRequest, renderer.M{
+				"message": msg(r, "Failed to update todo"),
+				"error": err,
+			})
+			return
+		}
+		set["title"], set["titleEncrypted"] = title, encrypted
+	}
+
+	for _, date := range []struct{ field, value string }{{"startAt", t.StartAt}, {"dueDate", t.DueDate}} {
+		field, value := date.field, date.value
+		at, err := parseOptionalTime(value, field)
+		if err != nil {
+			badRequest(w, r, err)
+			return
+		}
+		if at != nil {
+			set[field] = at
+		}
+	}
+
+	update := bson.M{"$set": set}
+	unset := bson.M{}
+	switch {
+	case t.Status == statusDone && !current.Completed:
+		set["completedAt"] = time.Now()
+	case t.Status != statusDone && current.Completed:
+		unset["completedAt"], unset["completedReason"] = "", ""
+	}
+
+	if t.Priority != "" {
+		if !validPriority(t.Priority) {
+			rnd.JSON(w, http.StatusBadRequest, renderer.M{
+				"message": msg(r, "Invalid priority"),
+			})
+			return
+		}
+		set["priority"] = t.Priority
+	}
+
+	// The description, subtasks and tags are only replaced when the
+	// client sends them.
+	if t.Description != nil {
+		if description := strings.TrimSpace(*t.Description); description != "" {
+			set["description"] = description
+		} else {
+			unset["description"] = ""
+		}
+	}
+
+	if t.Subtasks != nil {
+		subtasks, err := normalizeSubtasks(t.Subtasks)
+		if err != nil {
+			badRequest(w, r, err)
+			return
+		}
+		set["subtasks"] = subtasks
+	}
+
+	if t.Tags != nil {
+		tags, err := normalizeTags(t.Tags)
+		if err != nil {
+			badRequest(w, r, err)
+			return
+		}
+		set["tags"] = tags
+	}
+
+	if t.Reminders != nil {
+		reminders, err := parseReminders(t.Reminders)
+		if err != nil {
+			badRequest(w, r, err)
+			return
+		}
+		setReminders(set, unset, reminders, current)
+	}
+
+	// An update that changes nothing leaves updatedAt alone, so it is
+	// reported as modifying nothing.
+	if changes(current, set, unset) {
+		for k, v := range mutationStamp(r) {
+			set[k] = v
+		}
+	}
+
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	info, err := db.C(collectionName).UpdateAll(
+		bson.M{"_id": bson.ObjectIdHex(id)},
+		update,
+	)
+	if err != nil {
+		writeFailed(w, r, "Failed to update todo", err)
+		return
+	}
+	releaseChangedContent(current, set, unset)
+
+	// info is only reported for acknowledged writes.
+	if info == nil {
+		info = &mgo.ChangeInfo{}
+	} else if info.Matched == 0 {
+		rnd.JSON(w, http.StatusNotFound, renderer.M{
+			"message": msg(r, "Todo not found"),
+		})
+		return
+	}
+
+	rnd.JSON(w, http.StatusOK, renderer.M{
+		"message": msg(r, "Todo updated successfully"),
+		"matched": info.Matched,
+		"modified": info.Updated,
+	})
 }
 
 func main() {
-	stopChannel := make(chan os.Signal)
-	signal.Notify(stopChannel, os.Interrupt)
+	connect()
+
+	stopChannel := make(chan os.Signal, 1)
+	signal.Notify(stopChannel, os.Interrupt, syscall.SIGTERM)
+
+	if cfg.warmUp {
+		warmUp()
+	}
 
 	r := chi.NewRouter()
-	r.Use(middleware.Logger)
-	r.Get("/", homeHandler)
+	r.Use(assignRequestID(cfg.requestIDHeader))
+	r.Use(logRequests)
+	r.Use(recoverErrors)
+	r.Use(logSlowRequests(cfg.slowRequestThreshold))
+	r.Use(requireUserAgent(cfg.requireUserAgent, cfg.userAgentExempt))
+	r.Use(limitConcurrency(cfg.maxConcurrentRequests))
+	r.Use(rejectWritesDuring(cfg.readOnlyWindows))
+	if cfg.disableHTML {
+		r.Get("/", apiIndex)
+	} else {
+		loadTemplates()
+		r.Get("/", homeHandler)
+	}
+	r.Get("/healthz", healthz)
+	r.Get("/graphql", graphqlHandler)
+	r.Post("/graphql", graphqlHandler)
+	r.NotFound(notFound)
 	r.Mount("/todo", todoHandlers())
+	r.Mount("/admin", adminHandlers())
+
+	checkErr(chi.Walk(r, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		apiRoutes = append(apiRoutes, apiRoute{Method: method, Path: route})
+		return nil
+	}))
 
 	server := &http.Server{
 		Addr: port,
@@ -200,16 +1078,28 @@ func main() {
 		ReadTimeout: 60 * time.Second,
 		WriteTimeout: 60 * time.Second,
 		IdleTimeout: 60 * time.Second,
+		MaxHeaderBytes: cfg.maxHeaderBytes,
 	}
 
 	go func() {
-		log.Println("Listening on port", port)
-		if err := server.ListenAndServe(); err != nil {
+		log.Printf("Listening on port %s (read timeout %v, write timeout %v, idle timeout %v, max header bytes %d)",
+			port, server.ReadTimeout, server.WriteTimeout, server.IdleTimeout, server.MaxHeaderBytes)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			log.Fatal(err)
 		}
 	}()
+	ready.Store(true)
+
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	startJobs(jobsCtx)
 
 	<-stopChannel
+	stopJobs()
+	ready.Store(false)
+	if cfg.shutdownGracePeriod > 0 {
+		log.Println("Reporting not ready, draining for", cfg.shutdownGracePeriod)
+		time.Sleep(cfg.shutdownGracePeriod)
+	}
 	log.Println("Shutting down server...")
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	server.Shutdown(ctx)
@@ -222,8 +1112,29 @@ func todoHandlers() http.Handler {
 	rg.Group(func(r chi.Router) {
 		r.Get("/", getAllTodo)
 		r.Post("/", createTodo)
+		r.Get("/export", exportTodos)
+		r.Get("/calendar.ics", calendarFeed)
+		r.Get("/tree", todoTree)
+		r.Get("/by-tag", todosByTag)
+		r.Get("/focus", focusTodos)
+		r.Get("/next-due", nextDueTodo)
+		r.Get("/mine", openWork)
+		r.Post("/reminders/due", remindersDue)
+		r.Get("/activity", ownerActivity)
+		r.Post("/batch/priority", batchUpdatePriority)
+		r.Post("/validate", validateTodos)
+		r.Post("/import", importTodos)
+		r.Post("/claim", claimTodo)
+		r.Post("/batch-query", batchQuery)
+		r.Get("/{id}", getTodo)
 		r.Put("/{id}", updateTodo)
+		r.Patch("/{id}", patchTodo)
 		r.Delete("/{id}", deleteTodo)
+		r.Patch("/{id}/tags", patchTags)
+		r.Get("/{id}/rank", rankTodo)
+		r.Post("/{id}/touch", touchTodo)
+		r.Post("/{id}/move-after/{targetId}", moveTodo(true))
+		r.Post("/{id}/move-before/{targetId}", moveTodo(false))
 	})
 
 	return rg
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestTodoSort(t *testing.T) {
+	tests := []struct {
+		sort string
+		want []string
+	}{
+		{"", []string{"createdAt", "_id"}},
+		{"createdAt", []string{"createdAt", "_id"}},
+		{"-createdAt", []string{"-createdAt", "-_id"}},
+		{"position", []string{"position"}},
+		{"-title", []string{"-title"}},
+		{"seq", []string{"seq"}},
+	}
+	for _, tt := range tests {
+		got, err := todoSort(url.Values{"sort": {tt.sort}})
+		if err != nil {
+			t.Errorf("todoSort(%q) error: %v", tt.sort, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("todoSort(%q) = %v, want %v", tt.sort, got, tt.want)
+		}
+	}
+
+	if _, err := todoSort(url.Values{"sort": {"-_id"}}); err == nil {
+		t.Error("todoSort(\"-_id\") succeeded, want an error")
+	}
+}
+
+// TestTodoSortBreaksTies sorts todos created at the same moment by the keys
+// todoSort returns, the way MongoDB would, and checks they come out in _id
+// order rather than in the order they were stored.
+func TestTodoSortBreaksTies(t *testing.T) {
+	createdAt := time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+	ids := []string{
+		"65f000000000000000000003",
+		"65f000000000000000000001",
+		"65f000000000000000000004",
+		"65f000000000000000000002",
+	}
+
+	tests := []struct {
+		sort string
+		want []string
+	}{
+		{"createdAt", []string{ids[1], ids[3], ids[0], ids[2]}},
+		{"-createdAt", []string{ids[2], ids[0], ids[3], ids[1]}},
+	}
+	for _, tt := range tests {
+		keys, err := todoSort(url.Values{"sort": {tt.sort}})
+		if err != nil {
+			t.Fatalf("todoSort(%q) error: %v", tt.sort, err)
+		}
+
+		todos := []todoModel{}
+		for _, id := range ids {
+			todos = append(todos, todoModel{ID: bson.ObjectIdHex(id), CreatedAt: createdAt})
+		}
+		sort.SliceStable(todos, func(i, j int) bool {
+			for _, key := range keys {
+				field := strings.TrimPrefix(key, "-")
+				var c int
+				switch field {
+				case "createdAt":
+					c = int(todos[i].CreatedAt.Sub(todos[j].CreatedAt))
+				case "_id":
+					c = strings.Compare(todos[i].ID.Hex(), todos[j].ID.Hex())
+				default:
+					t.Fatalf("todoSort(%q) returned unexpected key %q", tt.sort, key)
+				}
+				if strings.HasPrefix(key, "-") {
+					c = -c
+				}
+				if c != 0 {
+					return c < 0
+				}
+			}
+			return false
+		})
+
+		got := []string{}
+		for _, todo := range todos {
+			got = append(got, todo.ID.Hex())
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("sort=%s order = %v, want %v", tt.sort, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/thedevsaddam/renderer"
+)
+
+// limitConcurrency rejects requests with 503 once max requests are already
+// in flight, protecting MongoDB from bursts of traffic. Health checks are
+// always let through.
+func limitConcurrency(max int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if max <= 0 {
+			return next
+		}
+
+		sem := make(chan struct{}, max)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/healthz" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+				next.ServeHTTP(w, r)
+			default:
+				w.Header().Set("Retry-After", "1")
+				rnd.JSON(w, http.StatusServiceUnavailable, renderer.M{
+					"message": msg(r, "Server is busy, try again later"),
+				})
+			}
+		})
+	}
+}
+
+// routePattern is the chi route pattern a request matched, such as
+// /todo/{id}, so logs group by endpoint instead of by concrete path.
+// Requests that matched no route share a single name.
+func routePattern(r *http.Request) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+		return rctx.RoutePattern()
+	}
+	return "unmatched"
+}
+
+// logRequests writes an access log line per request naming the matched
+// route pattern rather than the path, along with the status, response
+// size and duration.
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		start := time.Now()
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		requestLog(r).Printf("%s %s %d %dB in %v from %s", r.Method, routePattern(r), status, ww.BytesWritten(), time.Since(start), r.RemoteAddr)
+	})
+}
+
+// logSlowRequests warns about requests taking longer than threshold,
+// logging the matched route and query so slow queries can be reproduced.
+func logSlowRequests(threshold time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if threshold <= 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			next.ServeHTTP(w, r)
+
+			if elapsed := time.Since(start); elapsed > threshold {
+				requestLog(r).Printf("WARN slow request: %s %s query=%q took %v", r.Method, routePattern(r), r.URL.RawQuery, elapsed)
+			}
+		})
+	}
+}
+
+// requireUserAgent rejects requests that don't send a User-Agent header, a
+// crude filter for badly behaved bots. Paths equal to or under one of the
+// exempt prefixes are always let through.
+func requireUserAgent(enabled bool, exempt []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if !enabled {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.UserAgent() == "" && !hasPathPrefix(r.URL.Path, exempt) {
+				rnd.JSON(w, http.StatusBadRequest, renderer.M{
+					"message": msg(r, "User-Agent header is required"),
+				})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func hasPathPrefix(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		prefix = strings.TrimSuffix(prefix, "/")
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
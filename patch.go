@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/thedevsaddam/renderer"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// todoPatch holds the fields of a partial update. Fields left out of the
+// request stay nil and are not changed.
+type todoPatch struct {
+	Title       *string    `json:"title"`
+	Description *string    `json:"description"`
+	Status      *string    `json:"status"`
+	Completed   *bool      `json:"completed"`
+	Priority    *string    `json:"priority"`
+	Tags        *[]string  `json:"tags"`
+	Subtasks    *[]subtask `json:"subtasks"`
+	StartAt     *string    `json:"startAt"`
+	DueDate     *string    `json:"dueDate"`
+	Reminders   *[]string  `json:"reminders"`
+	ParentID    *string    `json:"parentId"`
+	Archived    *bool      `json:"archived"`
+}
+
+// build validates every field of the patch against current and returns the
+// update to apply, or the errors of all invalid fields.
+func (p todoPatch) build(current todoModel) (set, unset bson.M, errs map[string]string) {
+	set, unset, errs = bson.M{}, bson.M{}, map[string]string{}
+
+	if p.Title != nil {
+		title := normalizeTitle(*p.Title)
+		if err := validTitle(title); err != nil {
+			errs["title"] = err.Error()
+		} else if title == plainTitle(current) {
+			// Sealing an unchanged title would still yield new ciphertext.
+		} else if stored, encrypted, err := sealTitle(title); err != nil {
+			errs["title"] = err.Error()
+		} else {
+			set["title"], set["titleEncrypted"] = stored, encrypted
+		}
+	}
+
+	if p.Description != nil {
+		if description := strings.TrimSpace(*p.Description); description != "" {
+			set["description"] = description
+		} else {
+			unset["description"] = ""
+		}
+	}
+
+	status := ""
+	switch {
+	case p.Status != nil:
+		status = *p.Status
+		if !validStatus(status) {
+			errs["status"] = "Invalid status"
+		}
+	case p.Completed != nil:
+		status = statusFromCompleted(*p.Completed, current)
+	}
+	if status != "" && errs["status"] == "" {
+		set["status"], set["completed"] = status, status == statusDone
+		switch {
+		case status == statusDone && !current.Completed:
+			set["completedAt"] = time.Now()
+		case status != statusDone && current.Completed:
+			unset["completedAt"], unset["completedReason"] = "", ""
+		}
+	}
+
+	if p.Priority != nil {
+		if !validPriority(*p.Priority) {
+			errs["priority"] = "Invalid priority"
+		} else {
+			set["priority"] = *p.Priority
+		}
+	}
+
+	if p.Tags != nil {
+		if tags, err := normalizeTags(*p.Tags); err != nil {
+			errs["tags"] = err.Error()
+		} else {
+			set["tags"] = tags
+		}
+	}
+
+	if p.Subtasks != nil {
+		if subtasks, err := normalizeSubtasks(*p.Subtasks); err != nil {
+			errs["subtasks"] = err.Error()
+		} else {
+			set["subtasks"] = subtasks
+		}
+	}
+
+	if p.Reminders != nil {
+		if reminders, err := parseReminders(*p.Reminders); err != nil {
+			errs["reminders"] = err.Error()
+		} else {
+			setReminders(set, unset, reminders, current)
+		}
+	}
+
+	for _, date := range []struct {
+		field string
+		value *string
+	}{{"startAt", p.StartAt}, {"dueDate", p.DueDate}} {
+		field, value := date.field, date.value
+		if value == nil {
+			continue
+		}
+		if at, err := parseOptionalTime(*value, field); err != nil {
+			errs[field] = err.Error()
+		} else if at == nil {
+			unset[field] = ""
+		} else {
+			set[field] = *at
+		}
+	}
+
+	if p.ParentID != nil {
+		if parent, err := parseParentID(strings.TrimSpace(*p.ParentID)); err != nil {
+			errs["parentId"] = err.Error()
+		} else if parent == "" {
+			unset["parentId"] = ""
+		} else if err := checkParent(current.ID, parent); err != nil {
+			errs["parentId"] = err.Error()
+		} else {
+			set["parentId"] = parent
+		}
+	}
+
+	if p.Archived != nil && *p.Archived != current.Archived {
+		if *p.Archived {
+			set["archived"], set["archivedAt"] = true, time.Now()
+		} else {
+			unset["archived"], unset["archivedAt"] = "", ""
+		}
+	}
+
+	return set, unset, errs
+}
+
+// patchTodo updates only the fields sent by the client. All of them are
+// validated before anything is written, and the change is applied as a
+// single update, so a patch is either applied completely or not at all.
+func patchTodo(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSpace(chi.URLParam(r, "id"))
+
+	if !bson.IsObjectIdHex(id) {
+		rnd.JSON(w, http.StatusBadRequest, renderer.M{
+			"message": msg(r, "Invalid id"),
+		})
+		return
+	}
+
+	var p todoPatch
+
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		rnd.JSON(w, http.StatusBadRequest, renderer.M{
+			"message": msg(r, "Invalid request body"),
+		})
+		return
+	}
+
+	updated, err := changeTodo(id, r, func(todoModel) todoPatch { return p })
+	if err != nil {
+		storeFailed(w, r, err)
+		return
+	}
+
+	rnd.JSON(w, http.StatusOK, renderer.M{
+		"message": msg(r, "Todo updated successfully"),
+		"data":    toTodo(updated),
+	})
+}
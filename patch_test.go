@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestTodoPatchBuildCollectsInvalidFields(t *testing.T) {
+	title, status, priority := "", "bogus", priorityHigh
+	startAt, dueDate := "2026-01-02T15:04:05Z", "not a date"
+	tags := []string{"work"}
+	p := todoPatch{
+		Title:    &title,
+		Status:   &status,
+		Priority: &priority,
+		Tags:     &tags,
+		StartAt:  &startAt,
+		DueDate:  &dueDate,
+	}
+
+	set, _, errs := p.build(todoModel{ID: bson.NewObjectId(), Title: "Write tests", Priority: priorityMedium})
+
+	for _, field := range []string{"title", "status", "dueDate"} {
+		if errs[field] == "" {
+			t.Errorf("errs[%q] is empty, want an error", field)
+		}
+	}
+	for _, field := range []string{"priority", "tags", "startAt"} {
+		if errs[field] != "" {
+			t.Errorf("errs[%q] = %q, want no error", field, errs[field])
+		}
+		if _, ok := set[field]; !ok {
+			t.Errorf("set has no %q", field)
+		}
+	}
+	if len(errs) != 3 {
+		t.Errorf("errs = %v, want errors for title, status and dueDate only", errs)
+	}
+	for _, field := range []string{"title", "status", "completed", "dueDate"} {
+		if _, ok := set[field]; ok {
+			t.Errorf("set has invalid field %q", field)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/thedevsaddam/renderer"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Positions are fractional so a todo can be moved between two others by
+// rewriting only its own position.
+
+// nextPosition returns a position that sorts after every existing todo.
+func nextPosition() (float64, error) {
+	var last todoModel
+	err := db.C(collectionName).Find(bson.M{"position": bson.M{"$exists": true}}).
+		Sort("-position").One(&last)
+	if err == mgo.ErrNotFound {
+		return 1, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return last.Position + 1, nil
+}
+
+// migratePositions gives todos stored before positions existed a position
+// after all others, in creation order.
+func migratePositions() {
+	todos := []todoModel{}
+	err := db.C(collectionName).Find(bson.M{"position": bson.M{"$exists": false}}).
+		Sort("createdAt").All(&todos)
+	checkErr(err)
+	if len(todos) == 0 {
+		return
+	}
+
+	pos, err := nextPosition()
+	checkErr(err)
+	for _, t := range todos {
+		checkErr(db.C(collectionName).UpdateId(t.ID, bson.M{"$set": bson.M{"position": pos}}))
+		pos++
+	}
+	log.Printf("Assigned positions to %d todos", len(todos))
+}
+
+// rebalancePositions renumbers every todo to whole positions, making room
+// again once repeated moves have exhausted float precision between two
+// neighbours. Todos whose position changes are stamped as updated.
+func rebalancePositions() error {
+	todos := []todoModel{}
+	if err := db.C(collectionName).Find(nil).Sort("position", "_id").All(&todos); err != nil {
+		return err
+	}
+	now := time.Now()
+	for i, t := range todos {
+		pos := float64(i + 1)
+		if t.Position == pos {
+			continue
+		}
+		if err := db.C(collectionName).UpdateId(t.ID, bson.M{"$set": bson.M{"position": pos, "updatedAt": now}}); err != nil {
+			return err
+		}
+	}
+	log.Printf("Rebalanced positions of %d todos", len(todos))
+	return nil
+}
+
+// positionNextTo computes a position directly after (or before) target,
+// ignoring the todo being moved.
+func positionNextTo(moved, target todoModel, after bool) (float64, bool, error) {
+	query, sort, step := "$gt", "position", 1.0
+	if !after {
+		query, sort, step = "$lt", "-position", -1.0
+	}
+
+	var neighbor todoModel
+	err := db.C(collectionName).Find(bson.M{
+		"_id":      bson.M{"$ne": moved.ID},
+		"position": bson.M{query: target.Position},
+	}).Sort(sort).One(&neighbor)
+	if err == mgo.ErrNotFound {
+		return target.Position + step, true, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+
+	pos := (target.Position + neighbor.Position) / 2
+	return pos, pos != target.Position && pos != neighbor.Position, nil
+}
+
+func moveTodo(after bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimSpace(chi.URLParam(r, "id"))
+		targetID := strings.TrimSpace(chi.URLParam(r, "targetId"))
+
+		if !bson.IsObjectIdHex(id) || !bson.IsObjectIdHex(targetID) {
+			rnd.JSON(w, http.StatusBadRequest, renderer.M{
+				"message": msg(r, "Invalid id"),
+			})
+			return
+		}
+
+		if id == targetID {
+			rnd.JSON(w, http.StatusBadRequest, renderer.M{
+				"message": msg(r, "A todo cannot be moved relative to itself"),
+			})
+			return
+		}
+
+		var moved, target todoModel
+
+		if err := db.C(collectionName).FindId(bson.ObjectIdHex(id)).One(&moved); err != nil {
+			rnd.JSON(w, http.StatusNotFound, renderer.M{
+				"message": msg(r, "Todo not found"),
+			})
+			return
+		}
+
+		if err := db.C(collectionName).FindId(bson.ObjectIdHex(targetID)).One(&target); err != nil {
+			rnd.JSON(w, http.StatusNotFound, renderer.M{
+				"message": msg(r, "Target todo not found"),
+			})
+			return
+		}
+
+		pos, ok, err := positionNextTo(moved, target, after)
+		if err == nil && !ok {
+			if err = rebalancePositions(); err == nil {
+				err = db.C(collectionName).FindId(target.ID).One(&target)
+			}
+			if err == nil {
+				pos, _, err = positionNextTo(moved, target, after)
+			}
+		}
+		if err != nil {
+			rnd.JSON(w, http.StatusBadRequest, renderer.M{
+				"message": msg(r, "Failed to move todo"),
+				"error":   err,
+			})
+			return
+		}
+
+		set := mutationStamp(r)
+		set["position"] = pos
+		if err := db.C(collectionName).UpdateId(moved.ID, bson.M{"$set": set}); err != nil {
+			rnd.JSON(w, http.StatusBadRequest, renderer.M{
+				"message": msg(r, "Failed to move todo"),
+				"error":   err,
+			})
+			return
+		}
+		if err := db.C(collectionName).FindId(moved.ID).One(&moved); err != nil {
+			moved.Position = pos
+		}
+
+		rnd.JSON(w, http.StatusOK, renderer.M{
+			"message": msg(r, "Todo moved successfully"),
+			"data":    toTodo(moved),
+		})
+	}
+}
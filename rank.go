@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/thedevsaddam/renderer"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// sortsBefore builds a query matching the documents that sort before doc
+// under the given sort fields.
+func sortsBefore(doc bson.M, sort []string) bson.M {
+	or := []bson.M{}
+	equal := bson.M{}
+	for _, field := range sort {
+		op := "$lt"
+		if strings.HasPrefix(field, "-") {
+			field, op = field[1:], "$gt"
+		}
+
+		cond := bson.M{field: bson.M{op: doc[field]}}
+		for k, v := range equal {
+			cond[k] = v
+		}
+		or = append(or, cond)
+		equal[field] = doc[field]
+	}
+	return bson.M{"$or": or}
+}
+
+// rankTodo returns the 1-based position of a todo within a listing using
+// the same filters and sort as getAllTodo, counting the todos ahead of it
+// instead of loading the listing.
+func rankTodo(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSpace(chi.URLParam(r, "id"))
+
+	if !bson.IsObjectIdHex(id) {
+		rnd.JSON(w, http.StatusBadRequest, renderer.M{
+			"message": msg(r, "Invalid id"),
+		})
+		return
+	}
+
+	filter, err := todoFilter(r.URL.Query())
+	if err != nil {
+		badRequest(w, r, err)
+		return
+	}
+
+	sort, err := todoSort(r.URL.Query())
+	if err != nil {
+		badRequest(w, r, err)
+		return
+	}
+	if last := sort[len(sort)-1]; strings.TrimPrefix(last, "-") != "_id" {
+		sort = append(sort, "_id")
+	}
+
+	var doc bson.M
+	inView := bson.M{"$and": []bson.M{filter, {"_id": bson.ObjectIdHex(id)}}}
+	if err := db.C(collectionName).Find(inView).One(&doc); err != nil {
+		if err == mgo.ErrNotFound {
+			rnd.JSON(w, http.StatusNotFound, renderer.M{
+				"message": msg(r, "Todo not found"),
+			})
+			return
+		}
+		rnd.JSON(w, http.StatusBadRequest, renderer.M{
+			"message": msg(r, "Failed to get todo"),
+			"error":   err,
+		})
+		return
+	}
+
+	total, err := db.C(collectionName).Find(filter).Count()
+	if err != nil {
+		rnd.JSON(w, http.StatusBadRequest, renderer.M{
+			"message": msg(r, "Failed to rank todo"),
+			"error":   err,
+		})
+		return
+	}
+
+	ahead, err := db.C(collectionName).Find(bson.M{"$and": []bson.M{filter, sortsBefore(doc, sort)}}).Count()
+	if err != nil {
+		rnd.JSON(w, http.StatusBadRequest, renderer.M{
+			"message": msg(r, "Failed to rank todo"),
+			"error":   err,
+		})
+		return
+	}
+
+	rnd.JSON(w, http.StatusOK, renderer.M{
+		"data": renderer.M{
+			"id":    id,
+			"rank":  ahead + 1,
+			"total": total,
+		},
+	})
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/thedevsaddam/renderer"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const maxRemindersPerTodo = 20
+
+type dueReminder struct {
+	TodoID   string `json:"todoId"`
+	Title    string `json:"title"`
+	RemindAt string `json:"remindAt"`
+}
+
+// parseReminders parses RFC 3339 reminder times, returning them sorted
+// and without duplicates.
+func parseReminders(values []string) ([]time.Time, error) {
+	reminders := []time.Time{}
+	seen := map[time.Time]bool{}
+	for _, v := range values {
+		at, err := parseTime(v)
+		if err != nil {
+			return nil, &dateError{field: "reminders"}
+		}
+		// Stored timestamps have millisecond precision.
+		at = at.UTC().Truncate(time.Millisecond)
+		if !seen[at] {
+			seen[at] = true
+			reminders = append(reminders, at)
+		}
+	}
+	if len(reminders) > maxRemindersPerTodo {
+		return nil, errors.New("Too many reminders")
+	}
+	sort.Slice(reminders, func(i, j int) bool { return reminders[i].Before(reminders[j]) })
+	return reminders, nil
+}
+
+func formatReminders(reminders []time.Time) []string {
+	out := []string{}
+	for i := range reminders {
+		out = append(out, formatTime(&reminders[i]))
+	}
+	return out
+}
+
+// nextReminder returns the earliest of the sorted reminders that hasn't
+// fired yet, or nil when all have.
+func nextReminder(reminders, fired []time.Time) *time.Time {
+	for i, at := range reminders {
+		if !containsTime(fired, at) {
+			return &reminders[i]
+		}
+	}
+	return nil
+}
+
+func containsTime(times []time.Time, t time.Time) bool {
+	for _, at := range times {
+		if at.Equal(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// setReminders adds setting reminders on current to an update, keeping
+// nextReminderAt in step with them.
+func setReminders(set, unset bson.M, reminders []time.Time, current todoModel) {
+	set["reminders"] = reminders
+	if next := nextReminder(reminders, current.RemindersFired); next != nil {
+		set["nextReminderAt"] = *next
+	} else {
+		unset["nextReminderAt"] = ""
+	}
+}
+
+// migrateNextReminder gives todos with reminders stored before
+// nextReminderAt existed their next reminder.
+func migrateNextReminder() {
+	todos := []todoModel{}
+	err := db.C(collectionName).Find(bson.M{
+		"reminders":      bson.M{"$exists": true},
+		"nextReminderAt": bson.M{"$exists": false},
+	}).All(&todos)
+	checkErr(err)
+
+	for _, t := range todos {
+		if next := nextReminder(t.Reminders, t.RemindersFired); next != nil {
+			checkErr(db.C(collectionName).UpdateId(t.ID, bson.M{"$set": bson.M{"nextReminderAt": *next}}))
+		}
+	}
+}
+
+// remindersDue returns the reminders of incomplete todos that have fired
+// and weren't returned before, for up to maxPageSize todos per call.
+// Only todos whose nextReminderAt has passed are read, so already fired
+// reminders cost nothing. Each todo's reminders are marked fired with a
+// findAndModify conditioned on the nextReminderAt that was read, so
+// concurrent callers never get the same reminder twice, whatever the
+// write concern.
+func remindersDue(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	todos := []todoModel{}
+	err := db.C(collectionName).Find(bson.M{
+		"completed":      false,
+		"archived":       bson.M{"$ne": true},
+		"nextReminderAt": bson.M{"$lte": now},
+	}).Sort("nextReminderAt", "_id").Limit(maxPageSize).All(&todos)
+	if err != nil {
+		rnd.JSON(w, http.StatusBadRequest, renderer.M{
+			"message": msg(r, "Failed to get reminders"),
+			"error":   err,
+		})
+		return
+	}
+
+	due := []dueReminder{}
+	for _, t := range todos {
+		fired := []time.Time{}
+		for _, at := range t.Reminders {
+			if !at.After(now) && !containsTime(t.RemindersFired, at) {
+				fired = append(fired, at)
+			}
+		}
+
+		update := bson.M{"$addToSet": bson.M{"remindersFired": bson.M{"$each": fired}}}
+		if next := nextReminder(t.Reminders, append(t.RemindersFired, fired...)); next != nil {
+			update["$set"] = bson.M{"nextReminderAt": *next}
+		} else {
+			update["$unset"] = bson.M{"nextReminderAt": ""}
+		}
+
+		err := applyChange(db.C(collectionName), bson.M{
+			"_id":            t.ID,
+			"nextReminderAt": *t.NextReminderAt,
+		}, mgo.Change{Update: update}, nil)
+		if err == mgo.ErrNotFound {
+			// Another caller fired these reminders first.
+			continue
+		}
+		if err != nil {
+			writeFailed(w, r, "Failed to get reminders", err)
+			return
+		}
+
+		for i := range fired {
+			due = append(due, dueReminder{TodoID: t.ID.Hex(), Title: plainTitle(t), RemindAt: formatTime(&fired[i])})
+		}
+	}
+
+	rnd.JSON(w, http.StatusOK, renderer.M{
+		"data": due,
+	})
+}
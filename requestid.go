@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"regexp"
+)
+
+type requestIDKey struct{}
+
+// requestIDPattern keeps client supplied ids short and safe to log.
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// assignRequestID gives every request an id, taken from the request id
+// header when the client or a proxy sent a usable one and generated
+// otherwise. The id is echoed in the response header and prefixes every
+// log line written for the request.
+func assignRequestID(header string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(header)
+			if !requestIDPattern.MatchString(id) {
+				id = newRequestID()
+			}
+			w.Header().Set(header, id)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+		})
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// requestID returns the id assigned to r, or "" outside a request.
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey{}).(string)
+	return id
+}
+
+// requestLog returns a logger prefixing lines with the request id.
+func requestLog(r *http.Request) *log.Logger {
+	id := requestID(r)
+	if id == "" {
+		return log.Default()
+	}
+	return log.New(log.Writer(), log.Prefix()+"["+id+"] ", log.Flags())
+}
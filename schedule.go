@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thedevsaddam/renderer"
+)
+
+// timeWindow is a daily range of server local time, in minutes since
+// midnight. A window whose end is before its start runs past midnight.
+type timeWindow struct {
+	start, end int
+}
+
+// readOnlyExempt are the paths that accept POST without writing anything.
+var readOnlyExempt = []string{"/todo/validate", "/todo/batch-query"}
+
+// parseWindows parses "HH:MM-HH:MM" ranges, logging and skipping invalid
+// ones like the other settings do.
+func parseWindows(specs []string) []timeWindow {
+	windows := []timeWindow{}
+	for _, spec := range specs {
+		w, err := parseWindow(spec)
+		if err != nil {
+			log.Printf("Ignoring invalid read-only window %q: %v", spec, err)
+			continue
+		}
+		windows = append(windows, w)
+	}
+	return windows
+}
+
+func parseWindow(spec string) (timeWindow, error) {
+	from, to, ok := strings.Cut(spec, "-")
+	if !ok {
+		return timeWindow{}, errors.New("want HH:MM-HH:MM")
+	}
+	start, err := parseClock(from)
+	if err != nil {
+		return timeWindow{}, err
+	}
+	end, err := parseClock(to)
+	if err != nil {
+		return timeWindow{}, err
+	}
+	if start == end {
+		return timeWindow{}, errors.New("window is empty")
+	}
+	return timeWindow{start: start, end: end}, nil
+}
+
+func parseClock(v string) (int, error) {
+	h, m, ok := strings.Cut(strings.TrimSpace(v), ":")
+	if !ok {
+		return 0, fmt.Errorf("invalid time %q", v)
+	}
+	hour, err := strconv.Atoi(h)
+	if err != nil || hour < 0 || hour > 23 {
+		return 0, fmt.Errorf("invalid time %q", v)
+	}
+	minute, err := strconv.Atoi(m)
+	if err != nil || minute < 0 || minute > 59 {
+		return 0, fmt.Errorf("invalid time %q", v)
+	}
+	return hour*60 + minute, nil
+}
+
+// endsAt reports whether t falls within the window and, if so, when the
+// window ends.
+func (w timeWindow) endsAt(t time.Time) (time.Time, bool) {
+	minute := t.Hour()*60 + t.Minute()
+	day := func(offset, minutes int) time.Time {
+		return time.Date(t.Year(), t.Month(), t.Day()+offset, 0, minutes, 0, 0, t.Location())
+	}
+
+	if w.start < w.end {
+		if minute >= w.start && minute < w.end {
+			return day(0, w.end), true
+		}
+		return time.Time{}, false
+	}
+
+	switch {
+	case minute >= w.start:
+		return day(1, w.end), true
+	case minute < w.end:
+		return day(0, w.end), true
+	}
+	return time.Time{}, false
+}
+
+// readOnlyUntil reports whether t falls within one of the windows and, if
+// so, when writes are accepted again. Adjoining or overlapping windows are
+// followed until one ends outside all the others.
+func readOnlyUntil(windows []timeWindow, t time.Time) (time.Time, bool) {
+	until, readOnly := t, false
+	for i := 0; i <= len(windows); i++ {
+		extended := false
+		for _, w := range windows {
+			if end, ok := w.endsAt(until); ok {
+				until, readOnly, extended = end, true, true
+			}
+		}
+		if !extended {
+			break
+		}
+	}
+	return until, readOnly
+}
+
+// rejectWritesDuring answers mutating requests with 503 while the server
+// clock is within one of the read-only windows. Reads are always served.
+func rejectWritesDuring(windows []timeWindow) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(windows) == 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				next.ServeHTTP(w, r)
+				return
+			}
+			if hasPathPrefix(r.URL.Path, readOnlyExempt) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			now := time.Now()
+			until, readOnly := readOnlyUntil(windows, now)
+			if !readOnly {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("Retry-After", strconv.Itoa(int(until.Sub(now).Seconds())+1))
+			rnd.JSON(w, http.StatusServiceUnavailable, renderer.M{
+				"message":     msg(r, "The server is read-only for maintenance"),
+				"availableAt": until.Format(time.RFC3339),
+			})
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"log"
+	"sync"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// counterCollectionName holds one document per named counter.
+const counterCollectionName = "counters"
+
+// todoSeqCounter is the counter that numbers todos in insert order.
+const todoSeqCounter = "todoSeq"
+
+type counter struct {
+	ID  string `bson:"_id"`
+	Seq int64  `bson:"seq"`
+}
+
+// seqMu serializes taking a sequence number and inserting the todo that
+// gets it, so within this process no todo becomes visible before one
+// with a lower number. Creates wait on each other for it; that is the
+// price of an ordered, gap-free sequence.
+var seqMu sync.Mutex
+
+// nextSeq atomically increments the todo counter and returns its new
+// value. Callers hold seqMu until the todo is inserted.
+func nextSeq() (int64, error) {
+	var c counter
+	err := applyChange(db.C(counterCollectionName), bson.M{"_id": todoSeqCounter}, mgo.Change{
+		Update:    bson.M{"$inc": bson.M{"seq": 1}},
+		Upsert:    true,
+		ReturnNew: true,
+	}, &c)
+	return c.Seq, err
+}
+
+// releaseSeq gives back seq after the insert of its todo failed. The
+// counter is only decremented if nothing took a later number meanwhile;
+// otherwise seq stays a gap.
+func releaseSeq(seq int64) {
+	err := db.C(counterCollectionName).Update(
+		bson.M{"_id": todoSeqCounter, "seq": seq},
+		bson.M{"$inc": bson.M{"seq": -1}},
+	)
+	if err != nil && err != mgo.ErrNotFound {
+		log.Println("Failed to release sequence number", seq, err)
+	}
+}
+
+// migrateSeq numbers todos stored before sequence numbers existed, in
+// creation order, after any todo that already has one.
+func migrateSeq() {
+	todos := []todoModel{}
+	err := db.C(collectionName).Find(bson.M{"seq": bson.M{"$exists": false}}).
+		Sort("createdAt", "_id").All(&todos)
+	checkErr(err)
+
+	for _, t := range todos {
+		seq, err := nextSeq()
+		checkErr(err)
+		err = db.C(collectionName).UpdateId(t.ID, bson.M{"$set": bson.M{"seq": seq}})
+		checkErr(err)
+	}
+}
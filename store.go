@@ -0,0 +1,286 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/thedevsaddam/renderer"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// The todo store holds the operations on stored todos that are shared by
+// the REST handlers and the GraphQL endpoint, so both apply the same rules.
+// Mistakes a client can fix are returned as plain errors carrying the
+// message to show; a *storeError reports that the database failed.
+
+var (
+	errInvalidID    = errors.New("Invalid id")
+	errTodoNotFound = errors.New("Todo not found")
+	errTodoDeleted  = errors.New("Todo was deleted")
+)
+
+// storeError is a failed database read or write. message is what the
+// client is told, err the cause.
+type storeError struct {
+	message string
+	err     error
+}
+
+func (e *storeError) Error() string { return e.message }
+
+func (e *storeError) Unwrap() error { return e.err }
+
+// duplicateError rejects a create that repeats the content of todo id
+// within the dedupe window.
+type duplicateError struct {
+	id bson.ObjectId
+}
+
+func (e *duplicateError) Error() string { return "Duplicate todo" }
+
+// validationErrors are the reasons each invalid field of a patch was
+// rejected for.
+type validationErrors map[string]string
+
+func (e validationErrors) Error() string { return "Validation failed" }
+
+// todoPage is one page of a todo listing.
+type todoPage struct {
+	Data   []todo `json:"data"`
+	Total  int    `json:"total"`
+	Offset int    `json:"offset"`
+	Limit  int    `json:"limit"`
+}
+
+// listTodos returns the page of todos selected by the listing parameters
+// in q.
+func listTodos(q url.Values) (todoPage, error) {
+	filter, err := todoFilter(q)
+	if err != nil {
+		return todoPage{}, err
+	}
+	sort, err := todoSort(q)
+	if err != nil {
+		return todoPage{}, err
+	}
+	skip, limit, err := pagination(q)
+	if err != nil {
+		return todoPage{}, err
+	}
+
+	query := db.C(collectionName).Find(filter)
+	total, err := query.Count()
+	if err != nil {
+		return todoPage{}, &storeError{"Failed to get todos", err}
+	}
+
+	todos := []todoModel{}
+	if err := query.Sort(sort...).Skip(skip).Limit(limit).All(&todos); err != nil {
+		return todoPage{}, &storeError{"Failed to get todos", err}
+	}
+
+	page := todoPage{Data: []todo{}, Total: total, Offset: skip, Limit: limit}
+	for _, t := range todos {
+		page.Data = append(page.Data, toTodo(t))
+	}
+	return page, nil
+}
+
+// findTodo returns the todo with the given hex id. Ids of deleted todos
+// are told apart from ids that never existed.
+func findTodo(id string) (todoModel, error) {
+	id = strings.TrimSpace(id)
+	if !bson.IsObjectIdHex(id) {
+		return todoModel{}, errInvalidID
+	}
+
+	var t todoModel
+	err := db.C(collectionName).FindId(bson.ObjectIdHex(id)).One(&t)
+	if err == mgo.ErrNotFound {
+		if n, err := db.C(tombstoneCollectionName).FindId(bson.ObjectIdHex(id)).Count(); err == nil && n > 0 {
+			return todoModel{}, errTodoDeleted
+		}
+		return todoModel{}, errTodoNotFound
+	}
+	if err != nil {
+		return todoModel{}, &storeError{"Failed to get todo", err}
+	}
+	return t, nil
+}
+
+// addTodo validates and stores a new todo, returning it together with how
+// many unarchived todos its owner had before, for limit warnings.
+func addTodo(t todo, r *http.Request) (todoModel, int, error) {
+	todo, err := newTodo(t, r)
+	if err != nil {
+		return todoModel{}, 0, err
+	}
+
+	owned, err := checkOwnerLimit(todo.Owner)
+	if err == errOwnerLimit {
+		return todoModel{}, 0, err
+	}
+	if err != nil {
+		return todoModel{}, 0, &storeError{"Failed to create todo", err}
+	}
+
+	todo.ID = bson.NewObjectId()
+	if cfg.dedupeWindow > 0 {
+		existing, err := claimContent(todo)
+		if err != nil {
+			return todoModel{}, 0, &storeError{"Failed to create todo", err}
+		}
+		if existing != "" {
+			return todoModel{}, 0, &duplicateError{id: existing}
+		}
+	}
+
+	stored, err := storeTodo(todo)
+	if err != nil {
+		releaseContent(todo.ID)
+		return todoModel{}, 0, &storeError{"Failed to create todo", err}
+	}
+	return stored, owned, nil
+}
+
+// changeTodo applies the patch made from the current todo with the given
+// hex id, validating every field first, and returns the updated todo.
+// Nothing is written unless all fields are valid.
+func changeTodo(id string, r *http.Request, patch func(current todoModel) todoPatch) (todoModel, error) {
+	id = strings.TrimSpace(id)
+	if !bson.IsObjectIdHex(id) {
+		return todoModel{}, errInvalidID
+	}
+
+	var current todoModel
+	if err := db.C(collectionName).FindId(bson.ObjectIdHex(id)).One(&current); err != nil {
+		if err == mgo.ErrNotFound {
+			return todoModel{}, errTodoNotFound
+		}
+		return todoModel{}, &storeError{"Failed to update todo", err}
+	}
+
+	set, unset, errs := patch(current).build(current)
+	if len(errs) > 0 {
+		return todoModel{}, validationErrors(errs)
+	}
+
+	if changes(current, set, unset) {
+		for k, v := range mutationStamp(r) {
+			set[k] = v
+		}
+	}
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	var updated todoModel
+	if err := applyChange(db.C(collectionName), bson.M{"_id": current.ID}, mgo.Change{Update: update, ReturnNew: true}, &updated); err != nil {
+		if err == mgo.ErrNotFound {
+			return todoModel{}, errTodoNotFound
+		}
+		return todoModel{}, &storeError{"Failed to update todo", err}
+	}
+	releaseChangedContent(current, set, unset)
+	return updated, nil
+}
+
+// toggleTodo completes an open todo or reopens a completed one.
+func toggleTodo(id string, r *http.Request) (todoModel, error) {
+	return changeTodo(id, r, func(current todoModel) todoPatch {
+		completed := !current.Completed
+		return todoPatch{Completed: &completed}
+	})
+}
+
+// childrenMode reads how the children of a deleted todo are handled:
+// "reparent", the default, or "cascade". It reports whether to cascade.
+func childrenMode(mode string) (bool, error) {
+	switch mode {
+	case "", "reparent":
+		return false, nil
+	case "cascade":
+		return true, nil
+	}
+	return false, errors.New("Invalid children")
+}
+
+// removeTodo deletes the todo with the given hex id and returns it as it
+// was when deleted, which clients can use to offer undo.
+func removeTodo(id string, cascade bool) (todoModel, error) {
+	id = strings.TrimSpace(id)
+	if !bson.IsObjectIdHex(id) {
+		return todoModel{}, errInvalidID
+	}
+
+	// Remove with findAndModify so the todo returned is exactly the one
+	// that was deleted.
+	// A delete that didn't replicate in time still happened on the
+	// primary, so its children are handled before reporting it.
+	var deleted todoModel
+	err := applyChange(db.C(collectionName), bson.M{"_id": bson.ObjectIdHex(id)}, mgo.Change{Remove: true}, &deleted)
+	if err == mgo.ErrNotFound {
+		return todoModel{}, errTodoNotFound
+	}
+	if err != nil && !isWriteConcernError(err) {
+		return todoModel{}, &storeError{"Failed to delete todo", err}
+	}
+	durable := err
+
+	recordTombstones(deleted.ID)
+	releaseContent(deleted.ID)
+
+	if err := detachChildren(deleted, cascade); err != nil {
+		return deleted, &storeError{"Todo deleted but its subtodos could not be updated", err}
+	}
+	if durable != nil {
+		return deleted, &storeError{"Failed to delete todo", durable}
+	}
+	return deleted, nil
+}
+
+// storeFailed writes the REST response for an error from the todo store.
+func storeFailed(w http.ResponseWriter, r *http.Request, err error) {
+	var failed *storeError
+	var duplicate *duplicateError
+	var invalid validationErrors
+	switch {
+	case errors.As(err, &failed):
+		writeFailed(w, r, failed.message, failed.err)
+	case err == errTodoNotFound:
+		rnd.JSON(w, http.StatusNotFound, renderer.M{
+			"message": msg(r, err.Error()),
+		})
+	case err == errTodoDeleted:
+		rnd.JSON(w, http.StatusGone, renderer.M{
+			"message": msg(r, err.Error()),
+		})
+	case err == errOwnerLimit:
+		rnd.JSON(w, http.StatusConflict, renderer.M{
+			"message": msg(r, err.Error()),
+			"limit":   cfg.maxTodosPerOwner,
+		})
+	case errors.As(err, &duplicate):
+		rnd.JSON(w, http.StatusConflict, renderer.M{
+			"message": msg(r, err.Error()),
+			"id":      duplicate.id.Hex(),
+		})
+	case errors.As(err, &invalid):
+		response := renderer.M{"message": msg(r, err.Error())}
+		errs := map[string]string{}
+		for field, reason := range invalid {
+			if reason == (&dateError{field: field}).Error() {
+				response["acceptedFormats"] = dateExamples()
+			}
+			errs[field] = msg(r, reason)
+		}
+		response["errors"] = errs
+		rnd.JSON(w, http.StatusUnprocessableEntity, response)
+	default:
+		badRequest(w, r, err)
+	}
+}
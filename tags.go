@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/thedevsaddam/renderer"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const maxTagsPerTodo = 20
+
+// untaggedGroup is the group todos without tags are listed under by
+// todosByTag. It can't clash with a real tag, which must start with a
+// letter or digit.
+const untaggedGroup = "_untagged"
+
+var tagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// normalizeTags lowercases and trims tags, dropping duplicates, and checks
+// that each is a valid tag.
+func normalizeTags(tags []string) ([]string, error) {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if !tagPattern.MatchString(tag) {
+			return nil, errors.New("Invalid tag")
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			out = append(out, tag)
+		}
+	}
+	if len(out) > maxTagsPerTodo {
+		return nil, errors.New("Too many tags")
+	}
+	return out, nil
+}
+
+type tagPatch struct {
+	Add    []string `json:"add"`
+	Remove []string `json:"remove"`
+}
+
+// patchTags adds and removes individual tags with $addToSet and $pullAll,
+// so concurrent edits of different tags don't overwrite each other.
+func patchTags(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSpace(chi.URLParam(r, "id"))
+
+	if !bson.IsObjectIdHex(id) {
+		rnd.JSON(w, http.StatusBadRequest, renderer.M{
+			"message": msg(r, "Invalid id"),
+		})
+		return
+	}
+
+	var p tagPatch
+
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		rnd.JSON(w, http.StatusBadRequest, renderer.M{
+			"message": msg(r, "Invalid request body"),
+		})
+		return
+	}
+
+	add, err := normalizeTags(p.Add)
+	if err == nil {
+		p.Remove, err = normalizeTags(p.Remove)
+	}
+	if err != nil {
+		badRequest(w, r, err)
+		return
+	}
+
+	for _, tag := range add {
+		for _, removed := range p.Remove {
+			if tag == removed {
+				rnd.JSON(w, http.StatusBadRequest, renderer.M{
+					"message": msg(r, "A tag cannot be both added and removed"),
+				})
+				return
+			}
+		}
+	}
+
+	var current todoModel
+	if err := db.C(collectionName).FindId(bson.ObjectIdHex(id)).One(&current); err != nil {
+		if err == mgo.ErrNotFound {
+			rnd.JSON(w, http.StatusNotFound, renderer.M{
+				"message": msg(r, "Todo not found"),
+			})
+			return
+		}
+		rnd.JSON(w, http.StatusBadRequest, renderer.M{
+			"message": msg(r, "Failed to update tags"),
+			"error":   err,
+		})
+		return
+	}
+
+	resulting := map[string]bool{}
+	for _, tag := range append(current.Tags, add...) {
+		resulting[tag] = true
+	}
+	for _, tag := range p.Remove {
+		delete(resulting, tag)
+	}
+	if len(add) > 0 && len(resulting) > maxTagsPerTodo {
+		rnd.JSON(w, http.StatusBadRequest, renderer.M{
+			"message": msg(r, "Too many tags"),
+		})
+		return
+	}
+
+	// MongoDB rejects $addToSet and $pullAll on the same field in one
+	// update, so removals and additions are applied one after the other.
+	var updated todoModel
+	change := mgo.Change{ReturnNew: true}
+	if len(p.Remove) > 0 {
+		change.Update = bson.M{"$pullAll": bson.M{"tags": p.Remove}, "$set": mutationStamp(r)}
+		if err = applyChange(db.C(collectionName), bson.M{"_id": current.ID}, change, &updated); err != nil {
+			writeFailed(w, r, "Failed to update tags", err)
+			return
+		}
+	}
+	if len(add) > 0 {
+		change.Update = bson.M{"$addToSet": bson.M{"tags": bson.M{"$each": add}}, "$set": mutationStamp(r)}
+		if err = applyChange(db.C(collectionName), bson.M{"_id": current.ID}, change, &updated); err != nil {
+			writeFailed(w, r, "Failed to update tags", err)
+			return
+		}
+	}
+	if len(add) == 0 && len(p.Remove) == 0 {
+		updated = current
+	}
+
+	tags := updated.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+
+	rnd.JSON(w, http.StatusOK, renderer.M{
+		"message": msg(r, "Tags updated successfully"),
+		"data":    tags,
+	})
+}
+
+// todosByTag lists the todos matching the listing filters grouped by tag.
+// A todo appears under each of its tags. offset and limit apply to each
+// group, and total reports the full size of every group.
+func todosByTag(w http.ResponseWriter, r *http.Request) {
+	filter, err := todoFilter(r.URL.Query())
+	if err != nil {
+		badRequest(w, r, err)
+		return
+	}
+
+	sort, err := todoSort(r.URL.Query())
+	if err != nil {
+		badRequest(w, r, err)
+		return
+	}
+
+	skip, limit, err := pagination(r.URL.Query())
+	if err != nil {
+		badRequest(w, r, err)
+		return
+	}
+
+	todos := []todoModel{}
+	if err := capItems(db.C(collectionName).Find(filter).Sort(sort...)).All(&todos); err != nil {
+		rnd.JSON(w, http.StatusBadRequest, renderer.M{
+			"message": msg(r, "Failed to get todos"),
+			"error":   err,
+		})
+		return
+	}
+	if tooManyItems(w, r, len(todos)) {
+		return
+	}
+
+	groups := map[string][]todo{}
+	totals := map[string]int{}
+	add := func(group string, t todoModel) {
+		n := totals[group]
+		totals[group] = n + 1
+		if n >= skip && n < skip+limit {
+			groups[group] = append(groups[group], toTodo(t))
+		} else if _, ok := groups[group]; !ok {
+			groups[group] = []todo{}
+		}
+	}
+	for _, t := range todos {
+		if len(t.Tags) == 0 {
+			add(untaggedGroup, t)
+		}
+		for _, tag := range t.Tags {
+			add(tag, t)
+		}
+	}
+
+	rnd.JSON(w, http.StatusOK, renderer.M{
+		"data":   groups,
+		"total":  totals,
+		"offset": skip,
+		"limit":  limit,
+	})
+}
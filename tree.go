@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/thedevsaddam/renderer"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// todoNode is a todo with the todos nested under it.
+type todoNode struct {
+	todo
+	Children []*todoNode `json:"children"`
+}
+
+// parseParentID checks the format of a parent id sent by a client.
+func parseParentID(id string) (bson.ObjectId, error) {
+	if id == "" {
+		return "", nil
+	}
+	if !bson.IsObjectIdHex(id) {
+		return "", errors.New("Invalid parentId")
+	}
+	return bson.ObjectIdHex(id), nil
+}
+
+// checkParent verifies that parent exists and that making it the parent of
+// id would not make the todo its own ancestor. id is empty for new todos,
+// which can't be part of a cycle yet.
+func checkParent(id, parent bson.ObjectId) error {
+	if parent == id {
+		return errors.New("A todo cannot be its own parent")
+	}
+
+	seen := map[bson.ObjectId]bool{}
+	for ancestor := parent; ancestor != ""; {
+		if seen[ancestor] {
+			break
+		}
+		seen[ancestor] = true
+
+		var t todoModel
+		err := db.C(collectionName).FindId(ancestor).Select(bson.M{"parentId": 1}).One(&t)
+		if err == mgo.ErrNotFound {
+			if ancestor == parent {
+				return errors.New("Parent todo not found")
+			}
+			// The chain ends at a parent that was deleted.
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if t.ParentID == id && id != "" {
+			return errors.New("A todo cannot be its own ancestor")
+		}
+		ancestor = t.ParentID
+	}
+	return nil
+}
+
+// descendants returns the ids of every todo nested under id.
+func descendants(id bson.ObjectId) ([]bson.ObjectId, error) {
+	all := []bson.ObjectId{}
+	level := []bson.ObjectId{id}
+	for len(level) > 0 {
+		children := []todoModel{}
+		if err := db.C(collectionName).Find(bson.M{"parentId": bson.M{"$in": level}}).
+			Select(bson.M{"_id": 1}).All(&children); err != nil {
+			return nil, err
+		}
+		level = level[:0]
+		for _, c := range children {
+			level = append(level, c.ID)
+		}
+		all = append(all, level...)
+	}
+	return all, nil
+}
+
+// detachChildren handles the children of a deleted todo: with cascade they
+// are deleted along with all their descendants, otherwise they are moved up
+// to the deleted todo's own parent and stamped as updated.
+func detachChildren(deleted todoModel, cascade bool) error {
+	if !cascade {
+		update := bson.M{"$set": bson.M{"updatedAt": time.Now()}, "$unset": bson.M{"parentId": ""}}
+		if deleted.ParentID != "" {
+			update = bson.M{"$set": bson.M{"parentId": deleted.ParentID, "updatedAt": time.Now()}}
+		}
+		_, err := db.C(collectionName).UpdateAll(bson.M{"parentId": deleted.ID}, update)
+		return err
+	}
+
+	ids, err := descendants(deleted.ID)
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+	if _, err := db.C(collectionName).RemoveAll(bson.M{"_id": bson.M{"$in": ids}}); err != nil {
+		return err
+	}
+	recordTombstones(ids...)
+	releaseContent(ids...)
+	return nil
+}
+
+// recordTombstones remembers deleted ids so they can be told apart from ids
+// that never existed.
+func recordTombstones(ids ...bson.ObjectId) {
+	for _, id := range ids {
+		if _, err := db.C(tombstoneCollectionName).UpsertId(id, bson.M{
+			"$set": bson.M{"deletedAt": time.Now()},
+		}); err != nil {
+			log.Println("Failed to record tombstone for todo", id.Hex(), err)
+		}
+	}
+}
+
+// todoTree returns the todos matching the listing filters nested under
+// their parents. Todos whose parent is filtered out show up at the top.
+func todoTree(w http.ResponseWriter, r *http.Request) {
+	filter, err := todoFilter(r.URL.Query())
+	if err != nil {
+		badRequest(w, r, err)
+		return
+	}
+
+	sort, err := todoSort(r.URL.Query())
+	if err != nil {
+		badRequest(w, r, err)
+		return
+	}
+
+	todos := []todoModel{}
+	if err := capItems(db.C(collectionName).Find(filter).Sort(sort...)).All(&todos); err != nil {
+		rnd.JSON(w, http.StatusBadRequest, renderer.M{
+			"message": msg(r, "Failed to get todos"),
+			"error":   err,
+		})
+		return
+	}
+	if tooManyItems(w, r, len(todos)) {
+		return
+	}
+
+	nodes := map[bson.ObjectId]*todoNode{}
+	for _, t := range todos {
+		nodes[t.ID] = &todoNode{todo: toTodo(t), Children: []*todoNode{}}
+	}
+
+	roots := []*todoNode{}
+	for _, t := range todos {
+		if parent, ok := nodes[t.ParentID]; ok && t.ParentID != "" {
+			parent.Children = append(parent.Children, nodes[t.ID])
+		} else {
+			roots = append(roots, nodes[t.ID])
+		}
+	}
+
+	rnd.JSON(w, http.StatusOK, renderer.M{
+		"data": roots,
+	})
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/thedevsaddam/renderer"
+)
+
+// maxValidateBatch bounds how many todos a single validation request may
+// check.
+const maxValidateBatch = 1000
+
+type validationResult struct {
+	Index  int      `json:"index"`
+	Valid  bool     `json:"valid"`
+	Errors []string `json:"errors"`
+}
+
+// validateTodos checks a batch of todos against the create rules without
+// storing any of them, so clients can report problems before an import.
+func validateTodos(w http.ResponseWriter, r *http.Request) {
+	var todos []todo
+
+	if err := json.NewDecoder(r.Body).Decode(&todos); err != nil {
+		rnd.JSON(w, http.StatusBadRequest, renderer.M{
+			"message": msg(r, "Invalid request body"),
+		})
+		return
+	}
+
+	if len(todos) > maxValidateBatch {
+		rnd.JSON(w, http.StatusBadRequest, renderer.M{
+			"message": msg(r, "Too many todos"),
+		})
+		return
+	}
+
+	results := []validationResult{}
+	invalid := 0
+	for i, t := range todos {
+		result := validationResult{Index: i, Valid: true, Errors: []string{}}
+		if _, err := newTodo(t, r); err != nil {
+			result.Valid = false
+			result.Errors = append(result.Errors, msg(r, err.Error()))
+			invalid++
+		}
+		results = append(results, result)
+	}
+
+	rnd.JSON(w, http.StatusOK, renderer.M{
+		"data":    results,
+		"valid":   len(todos) - invalid,
+		"invalid": invalid,
+	})
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/thedevsaddam/renderer"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Server error codes reported when a write could not satisfy its write
+// concern.
+const (
+	codeWriteConcernFailed        = 64
+	codeUnknownReplWriteConcern   = 79
+	codeUnsatisfiableWriteConcern = 100
+)
+
+// writeConcernSafe maps the configured write concern to mgo's session
+// safety settings.
+func writeConcernSafe(concern string, timeoutMs int) (*mgo.Safe, error) {
+	switch concern {
+	case "unacknowledged":
+		return nil, nil
+	case "acknowledged", "":
+		return &mgo.Safe{}, nil
+	case "majority":
+		return &mgo.Safe{WMode: "majority", WTimeout: timeoutMs}, nil
+	}
+	return nil, fmt.Errorf("invalid TODO_WRITE_CONCERN %q", concern)
+}
+
+// isWriteConcernError reports whether err means the write was applied on
+// the primary but not acknowledged at the requested durability.
+func isWriteConcernError(err error) bool {
+	lerr, ok := err.(*mgo.LastError)
+	if !ok {
+		return false
+	}
+	switch lerr.Code {
+	case codeWriteConcernFailed, codeUnknownReplWriteConcern, codeUnsatisfiableWriteConcern:
+		return true
+	}
+	return lerr.WTimeout
+}
+
+// applyChange runs change on the first document in c matching query, in the
+// order of the sort fields, like mgo's Query.Apply. mgo doesn't send the
+// session's write concern with findAndModify, so with the majority write
+// concern the command is run here with it. A write that was applied but
+// didn't replicate in time fills result and returns the *mgo.LastError
+// that isWriteConcernError reports.
+func applyChange(c *mgo.Collection, query interface{}, change mgo.Change, result interface{}, sort ...string) error {
+	if cfg.writeConcern != "majority" {
+		_, err := c.Find(query).Sort(sort...).Apply(change, result)
+		return err
+	}
+
+	order := bson.D{}
+	for _, field := range sort {
+		if strings.HasPrefix(field, "-") {
+			order = append(order, bson.DocElem{Name: field[1:], Value: -1})
+		} else {
+			order = append(order, bson.DocElem{Name: field, Value: 1})
+		}
+	}
+	cmd := bson.D{{Name: "findAndModify", Value: c.Name}, {Name: "query", Value: query}}
+	if len(order) > 0 {
+		cmd = append(cmd, bson.DocElem{Name: "sort", Value: order})
+	}
+	if change.Remove {
+		cmd = append(cmd, bson.DocElem{Name: "remove", Value: true})
+	} else {
+		cmd = append(cmd,
+			bson.DocElem{Name: "update", Value: change.Update},
+			bson.DocElem{Name: "new", Value: change.ReturnNew},
+			bson.DocElem{Name: "upsert", Value: change.Upsert},
+		)
+	}
+	cmd = append(cmd, bson.DocElem{Name: "writeConcern", Value: bson.M{"w": "majority", "wtimeout": cfg.writeTimeoutMs}})
+
+	var reply struct {
+		Value     bson.Raw `bson:"value"`
+		LastError struct {
+			N int `bson:"n"`
+		} `bson:"lastErrorObject"`
+		WriteConcernError *struct {
+			Code    int    `bson:"code"`
+			Message string `bson:"errmsg"`
+			Info    struct {
+				WTimeout bool `bson:"wtimeout"`
+			} `bson:"errInfo"`
+		} `bson:"writeConcernError"`
+	}
+	session := c.Database.Session.Clone()
+	defer session.Close()
+	session.SetMode(mgo.Strong, false)
+	if err := session.DB(c.Database.Name).Run(cmd, &reply); err != nil {
+		if qerr, ok := err.(*mgo.QueryError); ok && qerr.Message == "No matching object found" {
+			return mgo.ErrNotFound
+		}
+		return err
+	}
+	if reply.LastError.N == 0 {
+		return mgo.ErrNotFound
+	}
+	if reply.Value.Kind != 0x0A && result != nil {
+		if err := reply.Value.Unmarshal(result); err != nil {
+			return err
+		}
+	}
+	if wce := reply.WriteConcernError; wce != nil {
+		return &mgo.LastError{Err: wce.Message, Code: wce.Code, WTimeout: wce.Info.WTimeout}
+	}
+	return nil
+}
+
+// writeFailed responds to a failed write, setting write concern failures
+// apart so clients know the write may not have persisted.
+func writeFailed(w http.ResponseWriter, r *http.Request, message string, err error) {
+	if isWriteConcernError(err) {
+		rnd.JSON(w, http.StatusInternalServerError, renderer.M{
+			"message": msg(r, "Write not durable"),
+			"error":   err,
+		})
+		return
+	}
+
+	rnd.JSON(w, http.StatusBadRequest, renderer.M{
+		"message": msg(r, message),
+		"error":   err,
+	})
+}